@@ -0,0 +1,60 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetCondition returns the condition of the type, or nil if it is not set.
+func (s *SecurityPolicyStatus) GetCondition(conditionType SecurityPolicyConditionType) *SecurityPolicyCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// IsConditionTrue returns true if the condition of the type is True.
+func (s *SecurityPolicyStatus) IsConditionTrue(conditionType SecurityPolicyConditionType) bool {
+	condition := s.GetCondition(conditionType)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// SetCondition adds or updates the condition of the same type.
+// LastTransitionTime is changed only when the status changes.
+func (s *SecurityPolicyStatus) SetCondition(condition SecurityPolicyCondition) {
+	existing := s.GetCondition(condition.Type)
+	if existing == nil {
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = metav1.Now()
+		}
+		s.Conditions = append(s.Conditions, condition)
+		return
+	}
+	if existing.Status != condition.Status {
+		existing.Status = condition.Status
+		existing.LastTransitionTime = condition.LastTransitionTime
+		if existing.LastTransitionTime.IsZero() {
+			existing.LastTransitionTime = metav1.Now()
+		}
+	}
+	existing.Reason = condition.Reason
+	existing.Message = condition.Message
+	existing.ObservedGeneration = condition.ObservedGeneration
+}
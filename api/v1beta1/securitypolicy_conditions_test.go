@@ -0,0 +1,46 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("SecurityPolicyStatus conditions", func() {
+	It("should keep LastTransitionTime while the status is unchanged", func() {
+		status := &SecurityPolicyStatus{}
+		past := metav1.NewTime(time.Now().Add(-time.Hour))
+		status.SetCondition(SecurityPolicyCondition{Type: ConditionReady, Status: corev1.ConditionFalse, Reason: "Pending", LastTransitionTime: past})
+
+		status.SetCondition(SecurityPolicyCondition{Type: ConditionReady, Status: corev1.ConditionFalse, Reason: "APIError", ObservedGeneration: 2})
+		condition := status.GetCondition(ConditionReady)
+		Expect(condition.LastTransitionTime).To(Equal(past))
+		Expect(condition.Reason).To(Equal("APIError"))
+		Expect(condition.ObservedGeneration).To(Equal(int64(2)))
+		Expect(status.IsConditionTrue(ConditionReady)).To(BeFalse())
+
+		status.SetCondition(SecurityPolicyCondition{Type: ConditionReady, Status: corev1.ConditionTrue, Reason: "Synced"})
+		Expect(status.GetCondition(ConditionReady).LastTransitionTime).NotTo(Equal(past))
+		Expect(status.IsConditionTrue(ConditionReady)).To(BeTrue())
+		Expect(status.Conditions).To(HaveLen(1))
+	})
+})
@@ -16,23 +16,226 @@ limitations under the License.
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 )
 
+// LabelSelectors selects nodes by key and value, or by matchLabels and matchExpressions of a label selector.
+// The selectors of a rule are ANDed.
 type LabelSelectors struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	// Key and Value match a node label, the same as an entry of matchLabels.
+	// +optional
+	Key string `json:"key,omitempty"`
+	// +optional
+	Value                string `json:"value,omitempty"`
+	metav1.LabelSelector `json:",inline"`
+}
+
+// AddressSourceType is the kind of the addresses of the nodes a rule matches.
+type AddressSourceType string
+
+const (
+	// AddressSourceExternalIP is the ExternalIP addresses of the nodes.
+	AddressSourceExternalIP AddressSourceType = "ExternalIP"
+	// AddressSourceInternalIP is the InternalIP addresses of the nodes.
+	AddressSourceInternalIP AddressSourceType = "InternalIP"
+	// AddressSourceIPv6 is the IPv6 addresses of the nodes, either ExternalIP or InternalIP.
+	AddressSourceIPv6 AddressSourceType = "IPv6"
+	// AddressSourceAnnotation is the egress NAT IPs in an annotation of the nodes.
+	AddressSourceAnnotation AddressSourceType = "Annotation"
+	// AddressSourceConfigMap is the egress NAT IPs in a ConfigMap, such as the IPs of Cloud NAT.
+	AddressSourceConfigMap AddressSourceType = "ConfigMap"
+)
+
+// AddressSource is the source of the addresses of the nodes a rule matches.
+// Each IP is matched as a /32 or /128 range.
+type AddressSource struct {
+	// +kubebuilder:validation:Enum=ExternalIP;InternalIP;IPv6;Annotation;ConfigMap
+	Type AddressSourceType `json:"type"`
+	// Annotation is the node annotation of comma separated IPs, required by Annotation type.
+	// +optional
+	Annotation string `json:"annotation,omitempty"`
+	// ConfigMapKeyRef is the key of a ConfigMap in the namespace of the security policy,
+	// whose value is comma or whitespace separated IPs. It is required by ConfigMap type.
+	// The IPs are matched while the nodePoolSelectors select any node.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+}
+
+// NodeFilter narrows the nodes a rule matches by their state, and keeps the addresses of the removed nodes
+// for a while, so that flapping nodes do not patch the security policy repeatedly.
+type NodeFilter struct {
+	// ReadyOnly matches only the nodes whose Ready condition is True.
+	// +optional
+	ReadyOnly bool `json:"readyOnly,omitempty"`
+	// ExcludeUnschedulable excludes the cordoned nodes and the nodes being deleted,
+	// including the nodes the cluster autoscaler is scaling down.
+	// +optional
+	ExcludeUnschedulable bool `json:"excludeUnschedulable,omitempty"`
+	// GracePeriodSeconds keeps the addresses of the nodes removed from the rule for the seconds.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	GracePeriodSeconds int64 `json:"gracePeriodSeconds,omitempty"`
+}
+
+// PreconfiguredWafExclusionField is a request field to exclude from the inspection of a preconfigured WAF rule set.
+type PreconfiguredWafExclusionField struct {
+	// Operator matches the field name, or the request URI for requestUris.
+	// EQUALS_ANY matches any field, and requires value to be empty.
+	// +kubebuilder:validation:Enum=EQUALS;STARTS_WITH;ENDS_WITH;CONTAINS;EQUALS_ANY
+	Operator string `json:"operator"`
+	// +optional
+	Value string `json:"value,omitempty"`
+}
+
+// PreconfiguredWafExclusion excludes request fields from the inspection of the signatures.
+type PreconfiguredWafExclusion struct {
+	// TargetRuleIDs are the signatures the exclusion applies to.
+	// Empty applies to all signatures of the rule set.
+	TargetRuleIDs      []string                         `json:"targetRuleIds,omitempty"`
+	RequestHeaders     []PreconfiguredWafExclusionField `json:"requestHeaders,omitempty"`
+	RequestCookies     []PreconfiguredWafExclusionField `json:"requestCookies,omitempty"`
+	RequestQueryParams []PreconfiguredWafExclusionField `json:"requestQueryParams,omitempty"`
+	RequestUris        []PreconfiguredWafExclusionField `json:"requestUris,omitempty"`
+}
+
+// PreconfiguredWaf matches a preconfigured WAF rule set, such as sqli-v33-stable.
+// It is converted to the evaluatePreconfiguredWaf expression.
+type PreconfiguredWaf struct {
+	// RuleSet is the name of the preconfigured rule set, such as sqli-v33-stable or xss-v33-stable.
+	// +kubebuilder:validation:MinLength=1
+	RuleSet string `json:"ruleSet"`
+	// Sensitivity is the sensitivity level of the signatures to evaluate.
+	// 0 evaluates only the signatures of optInRuleIds.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=4
+	// +optional
+	Sensitivity *int64 `json:"sensitivity,omitempty"`
+	// OptInRuleIDs are the signatures to evaluate in addition to the sensitivity. It requires sensitivity 0.
+	OptInRuleIDs []string `json:"optInRuleIds,omitempty"`
+	// OptOutRuleIDs are the signatures not to evaluate.
+	OptOutRuleIDs []string                    `json:"optOutRuleIds,omitempty"`
+	Exclusions    []PreconfiguredWafExclusion `json:"exclusions,omitempty"`
+}
+
+// RateLimitThreshold is the number of requests in the interval.
+type RateLimitThreshold struct {
+	// +kubebuilder:validation:Minimum=1
+	Count int64 `json:"count"`
+	// +kubebuilder:validation:Enum=10;30;60;120;180;240;300;600;900;1200;1800;2700;3600
+	IntervalSec int64 `json:"intervalSec"`
+}
+
+// RateLimitOptions are the options of throttle and rate_based_ban actions.
+type RateLimitOptions struct {
+	// RateLimitThreshold is the threshold to apply exceedAction to the client.
+	RateLimitThreshold RateLimitThreshold `json:"rateLimitThreshold"`
+	// ConformAction is the action for the requests under the threshold. Defaults to allow.
+	// +kubebuilder:validation:Enum=allow
+	// +optional
+	ConformAction string `json:"conformAction,omitempty"`
+	// ExceedAction is the action for the requests over the threshold.
+	// +kubebuilder:validation:Enum=deny(403);deny(404);deny(429);deny(502)
+	ExceedAction string `json:"exceedAction"`
+	// BanDurationSec is the seconds to ban the client for. It is required by rate_based_ban.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	BanDurationSec int64 `json:"banDurationSec,omitempty"`
+	// BanThreshold is the threshold to ban the client for banDurationSec. It is allowed only for rate_based_ban.
+	// Defaults to rateLimitThreshold.
+	// +optional
+	BanThreshold *RateLimitThreshold `json:"banThreshold,omitempty"`
+	// EnforceOnKey is the key to count the requests by. Defaults to ALL.
+	// +kubebuilder:validation:Enum=ALL;IP;HTTP_HEADER;XFF_IP;HTTP_COOKIE;HTTP_PATH;REGION_CODE
+	// +optional
+	EnforceOnKey string `json:"enforceOnKey,omitempty"`
+	// EnforceOnKeyName is the name of the header or cookie for HTTP_HEADER and HTTP_COOKIE.
+	// +optional
+	EnforceOnKeyName string `json:"enforceOnKeyName,omitempty"`
+}
+
+// RedirectOptions are the options of redirect action.
+type RedirectOptions struct {
+	// Type is EXTERNAL_302 to redirect to target, or GOOGLE_RECAPTCHA to challenge the client with reCAPTCHA.
+	// +kubebuilder:validation:Enum=EXTERNAL_302;GOOGLE_RECAPTCHA
+	Type string `json:"type"`
+	// Target is the URL to redirect to. It is required by EXTERNAL_302, and not allowed for GOOGLE_RECAPTCHA.
+	// +optional
+	Target string `json:"target,omitempty"`
+}
+
+// RequestHeader is a header to add to the requests the rule matched.
+type RequestHeader struct {
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// +optional
+	Value string `json:"value,omitempty"`
 }
 
 // SecurityPolicyRule defines rules
+// A rule matches one of addresses (srcIpRanges and nodePoolSelectors), an expression or a preconfigured WAF rule set.
 type SecurityPolicyRule struct {
 	// +kubebuilder:validation:MinLength=1
 	Action string `json:"action"`
 	// +kubebuilder:validation:MinLength=1
-	Description       string           `json:"description"`
-	Priority          int64            `json:"priority"`
-	SrcIpRanges       []string         `json:"srcIpRanges,omitempty"`
+	Description string `json:"description"`
+	// Priority is the order Cloud Armor evaluates the rule in, lower first. It must be unique in the policy,
+	// and DefaultRulePriority is left to the default rule.
+	// +kubebuilder:validation:Maximum=2147483646
+	Priority    int64    `json:"priority"`
+	SrcIpRanges []string `json:"srcIpRanges,omitempty"`
+	// +kubebuilder:validation:MinItems=1
 	NodePoolSelectors []LabelSelectors `json:"nodePoolSelectors,omitempty"`
+	// AddressSource selects the addresses the nodes of nodePoolSelectors are resolved to. Defaults to ExternalIP.
+	// +optional
+	AddressSource *AddressSource `json:"addressSource,omitempty"`
+	// NodeFilter narrows the nodes of nodePoolSelectors by their state.
+	// +optional
+	NodeFilter *NodeFilter `json:"nodeFilter,omitempty"`
+	// Expression is a Cloud Armor rules language expression to match, such as "origin.region_code == 'RU'".
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	Expression string `json:"expression,omitempty"`
+	// PreconfiguredWaf matches a preconfigured WAF rule set.
+	// +optional
+	PreconfiguredWaf *PreconfiguredWaf `json:"preconfiguredWaf,omitempty"`
+	// RateLimitOptions are required by throttle and rate_based_ban actions.
+	// +optional
+	RateLimitOptions *RateLimitOptions `json:"rateLimitOptions,omitempty"`
+	// RedirectOptions are required by redirect action.
+	// +optional
+	RedirectOptions *RedirectOptions `json:"redirectOptions,omitempty"`
+	// RequestHeadersToAdd are the headers to add to the requests the rule matched before they reach the backends.
+	// They are not allowed for deny actions.
+	// +optional
+	RequestHeadersToAdd []RequestHeader `json:"requestHeadersToAdd,omitempty"`
+	// Preview only logs the action of the rule in Cloud Armor, without enforcing it.
+	// +optional
+	Preview bool `json:"preview,omitempty"`
+}
+
+// DefaultRulePriority is the priority of the default rule. Rules can not use it.
+const DefaultRulePriority int64 = 2147483647
+
+// DefaultRule is the default rule of the security policy, which matches all addresses.
+type DefaultRule struct {
+	// +kubebuilder:validation:Enum=allow;deny(403);deny(404);deny(502);throttle;redirect
+	Action string `json:"action"`
+	// Description defaults to "This is default action".
+	// +optional
+	Description string `json:"description,omitempty"`
+	// Preview only logs the action of the default rule in Cloud Armor, without enforcing it.
+	// previewRules of the spec does not apply to the default rule.
+	// +optional
+	Preview bool `json:"preview,omitempty"`
+	// RateLimitOptions are required by throttle action.
+	// +optional
+	RateLimitOptions *RateLimitOptions `json:"rateLimitOptions,omitempty"`
+	// RedirectOptions are required by redirect action.
+	// +optional
+	RedirectOptions *RedirectOptions `json:"redirectOptions,omitempty"`
 }
 
 // SecurityPolicySpec defines the desired state of SecurityPolicy
@@ -42,21 +245,280 @@ type SecurityPolicySpec struct {
 	Name string `json:"name"`
 	// +kubebuilder:validation:MinLength=1
 	Description string `json:"description"`
-	// +kubebuilder:validation:Enum=deny(403);deny(404);deny(502)
-	DefaultAction string               `json:"defaultAction"`
-	Rules         []SecurityPolicyRule `json:"rules,omitempty"`
+	// Type is the type of the security policy. Defaults to CLOUD_ARMOR. It can not be changed after the policy is created.
+	// +kubebuilder:validation:Enum=CLOUD_ARMOR;CLOUD_ARMOR_EDGE;CLOUD_ARMOR_NETWORK
+	// +optional
+	Type SecurityPolicyType `json:"type,omitempty"`
+	// Region is the region of the regional security policy, such as asia-northeast1.
+	// Unset creates the global security policy. CLOUD_ARMOR_NETWORK requires it, and CLOUD_ARMOR_EDGE does not allow it.
+	// +kubebuilder:validation:Pattern=`^[a-z]+-[a-z]+[0-9]+$`
+	// +optional
+	Region string `json:"region,omitempty"`
+	// DefaultAction is the action of the default rule, the shorthand of defaultRule.action.
+	// One of defaultAction or defaultRule must be set.
+	// +kubebuilder:validation:Enum=allow;deny(403);deny(404);deny(502)
+	// +optional
+	DefaultAction string `json:"defaultAction,omitempty"`
+	// DefaultRule is the rule with the lowest priority, which matches every request the other rules did not.
+	// +optional
+	DefaultRule *DefaultRule         `json:"defaultRule,omitempty"`
+	Rules       []SecurityPolicyRule `json:"rules,omitempty"`
+	// DriftAction is what to do when the security policy in Cloud Armor was changed outside of the operator.
+	// Correct applies the spec again, Report only records the drift. Defaults to Correct.
+	// +kubebuilder:validation:Enum=Correct;Report
+	// +optional
+	DriftAction DriftAction `json:"driftAction,omitempty"`
+	// PreviewRules puts every rule except the default rule in preview, regardless of the preview of the rule.
+	// +optional
+	PreviewRules bool `json:"previewRules,omitempty"`
+	// RecaptchaOptionsConfig configures the reCAPTCHA challenge of GOOGLE_RECAPTCHA redirect.
+	// +optional
+	RecaptchaOptionsConfig *RecaptchaOptionsConfig `json:"recaptchaOptionsConfig,omitempty"`
+	// AdaptiveProtection configures Cloud Armor Adaptive Protection. Unset disables it.
+	// +optional
+	AdaptiveProtection *AdaptiveProtection `json:"adaptiveProtection,omitempty"`
+	// AdvancedOptionsConfig configures JSON parsing, logging and the client IP of the requests. Unset restores the defaults.
+	// +optional
+	AdvancedOptionsConfig *AdvancedOptionsConfig `json:"advancedOptionsConfig,omitempty"`
+}
+
+// AdvancedOptionsConfig configures the advanced options of the security policy.
+type AdvancedOptionsConfig struct {
+	// JsonParsing lets the preconfigured WAF rules inspect JSON bodies. Defaults to DISABLED.
+	// +kubebuilder:validation:Enum=DISABLED;STANDARD
+	// +optional
+	JsonParsing string `json:"jsonParsing,omitempty"`
+	// JsonCustomConfig lists the content types parsed as JSON besides application/json. It requires STANDARD jsonParsing.
+	// +optional
+	JsonCustomConfig *JsonCustomConfig `json:"jsonCustomConfig,omitempty"`
+	// LogLevel is the level of the request logs. VERBOSE logs the matched fields of WAF rules. Defaults to NORMAL.
+	// +kubebuilder:validation:Enum=NORMAL;VERBOSE
+	// +optional
+	LogLevel string `json:"logLevel,omitempty"`
+	// UserIpRequestHeaders are the headers to read the client IP from, such as True-Client-IP.
+	// +optional
+	UserIpRequestHeaders []string `json:"userIpRequestHeaders,omitempty"`
+}
+
+// JsonCustomConfig lists the custom content types of JSON bodies.
+type JsonCustomConfig struct {
+	// ContentTypes are media types, such as application/vnd.api+json.
+	// +kubebuilder:validation:MinItems=1
+	ContentTypes []string `json:"contentTypes"`
+}
+
+// AdaptiveProtection configures Cloud Armor Adaptive Protection of the security policy.
+type AdaptiveProtection struct {
+	Layer7DdosDefenseConfig Layer7DdosDefenseConfig `json:"layer7DdosDefenseConfig"`
+}
+
+// Layer7DdosDefenseConfig configures the detection of layer 7 DDoS attacks.
+type Layer7DdosDefenseConfig struct {
+	Enable bool `json:"enable"`
+	// RuleVisibility is the visibility of the suggested rules. Defaults to STANDARD.
+	// +kubebuilder:validation:Enum=STANDARD;PREMIUM
+	// +optional
+	RuleVisibility string `json:"ruleVisibility,omitempty"`
+	// ThresholdConfigs are the thresholds to deploy the suggested rules automatically.
+	// +optional
+	ThresholdConfigs []Layer7DdosDefenseThresholdConfig `json:"thresholdConfigs,omitempty"`
+}
+
+// Layer7DdosDefenseThresholdConfig is a named set of thresholds to deploy the suggested rules automatically.
+// The thresholds are decimals between 0 and 1, such as "0.8".
+type Layer7DdosDefenseThresholdConfig struct {
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// +kubebuilder:validation:Pattern=`^(0(\.[0-9]+)?|1(\.0+)?|\.[0-9]+)$`
+	// +optional
+	AutoDeployLoadThreshold string `json:"autoDeployLoadThreshold,omitempty"`
+	// +kubebuilder:validation:Pattern=`^(0(\.[0-9]+)?|1(\.0+)?|\.[0-9]+)$`
+	// +optional
+	AutoDeployConfidenceThreshold string `json:"autoDeployConfidenceThreshold,omitempty"`
+	// +kubebuilder:validation:Pattern=`^(0(\.[0-9]+)?|1(\.0+)?|\.[0-9]+)$`
+	// +optional
+	AutoDeployImpactedBaselineThreshold string `json:"autoDeployImpactedBaselineThreshold,omitempty"`
+	// AutoDeployExpirationSec is the seconds the deployed rules are kept.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	AutoDeployExpirationSec int64 `json:"autoDeployExpirationSec,omitempty"`
+}
+
+// RecaptchaOptionsConfig configures the reCAPTCHA challenge of the security policy.
+type RecaptchaOptionsConfig struct {
+	// RedirectSiteKey is the reCAPTCHA site key for the challenge page,
+	// such as projects/PROJECT/keys/KEY. Defaults to the key managed by Google.
+	// +kubebuilder:validation:MinLength=1
+	RedirectSiteKey string `json:"redirectSiteKey"`
+}
+
+// SecurityPolicyDefaultRule returns the default rule of the spec as a rule matching all addresses.
+// defaultRule is preferred to defaultAction.
+func (s *SecurityPolicySpec) SecurityPolicyDefaultRule() SecurityPolicyRule {
+	rule := SecurityPolicyRule{
+		Action:      s.DefaultAction,
+		Description: "This is default action",
+		Priority:    DefaultRulePriority,
+		SrcIpRanges: []string{"*"},
+	}
+	if d := s.DefaultRule; d != nil {
+		rule.Action = d.Action
+		if d.Description != "" {
+			rule.Description = d.Description
+		}
+		rule.Preview = d.Preview
+		rule.RateLimitOptions = d.RateLimitOptions
+		rule.RedirectOptions = d.RedirectOptions
+	}
+	return rule
+}
+
+// NodeSelector returns the selector of the nodes which the nodePoolSelectors of the rule select.
+func (r *SecurityPolicyRule) NodeSelector() (labels.Selector, error) {
+	selector := labels.NewSelector()
+	for _, s := range r.NodePoolSelectors {
+		if s.Key != "" {
+			requirement, err := labels.NewRequirement(s.Key, selection.Equals, []string{s.Value})
+			if err != nil {
+				return nil, err
+			}
+			selector = selector.Add(*requirement)
+		}
+		labelSelector, err := metav1.LabelSelectorAsSelector(&s.LabelSelector)
+		if err != nil {
+			return nil, err
+		}
+		if requirements, ok := labelSelector.Requirements(); ok {
+			selector = selector.Add(requirements...)
+		}
+	}
+	return selector, nil
+}
+
+// SecurityPolicyType is the type of the security policy in Cloud Armor.
+type SecurityPolicyType string
+
+const (
+	// SecurityPolicyTypeCloudArmor is the backend security policy of HTTP(S) load balancers.
+	SecurityPolicyTypeCloudArmor SecurityPolicyType = "CLOUD_ARMOR"
+	// SecurityPolicyTypeCloudArmorEdge is the edge security policy of Cloud CDN and backend buckets.
+	SecurityPolicyTypeCloudArmorEdge SecurityPolicyType = "CLOUD_ARMOR_EDGE"
+	// SecurityPolicyTypeCloudArmorNetwork is the regional network edge security policy of passthrough load balancers.
+	SecurityPolicyTypeCloudArmorNetwork SecurityPolicyType = "CLOUD_ARMOR_NETWORK"
+)
+
+// DriftAction is what to do when the security policy in Cloud Armor drifted from the spec.
+type DriftAction string
+
+const (
+	// DriftActionCorrect applies the spec again to Cloud Armor.
+	DriftActionCorrect DriftAction = "Correct"
+	// DriftActionReport records the drift with an event and the Synced condition, without changing Cloud Armor.
+	DriftActionReport DriftAction = "Report"
+)
+
+// SecurityPolicyConditionType is a type of SecurityPolicy condition.
+type SecurityPolicyConditionType string
+
+const (
+	// ConditionReady is True when the security policy is synced with resolved node addresses.
+	ConditionReady SecurityPolicyConditionType = "Ready"
+	// ConditionSynced is True when Cloud Armor has the security policy of the spec.
+	ConditionSynced SecurityPolicyConditionType = "Synced"
+	// ConditionNodeAddressesResolved is True when the addresses of nodePoolSelectors are resolved.
+	ConditionNodeAddressesResolved SecurityPolicyConditionType = "NodeAddressesResolved"
+	// ConditionDegraded is True when the last reconcile failed.
+	ConditionDegraded SecurityPolicyConditionType = "Degraded"
+)
+
+// SecurityPolicyCondition describes the state of SecurityPolicy, in the shape of metav1.Condition.
+type SecurityPolicyCondition struct {
+	Type SecurityPolicyConditionType `json:"type"`
+	// +kubebuilder:validation:Enum=True;False;Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// ObservedGeneration is the .metadata.generation that the condition was set based upon.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastTransitionTime is the last time the condition transitioned from one status to another.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a CamelCase reason for the condition's last transition.
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable message indicating details about the transition.
+	Message string `json:"message,omitempty"`
+}
+
+// SecurityPolicyRuleStatus is a rule read back from Cloud Armor.
+type SecurityPolicyRuleStatus struct {
+	Action      string `json:"action"`
+	Description string `json:"description,omitempty"`
+	Priority    int64  `json:"priority"`
+	// SrcIpRanges includes the addresses expanded from nodePoolSelectors.
+	SrcIpRanges []string `json:"srcIpRanges,omitempty"`
+	Expression  string   `json:"expression,omitempty"`
+	Preview     bool     `json:"preview,omitempty"`
+}
+
+// SplitRuleStatus is a rule split into the rules of consecutive priorities in Cloud Armor.
+type SplitRuleStatus struct {
+	// Priority is the priority of the rule in the spec.
+	Priority int64 `json:"priority"`
+	// Priorities are the priorities of the split rules in Cloud Armor, starting with Priority.
+	Priorities []int64 `json:"priorities"`
+}
+
+// NodeAddressesStatus is the addresses of a nodePoolSelectors rule the operator applied to Cloud Armor.
+type NodeAddressesStatus struct {
+	// Priority is the priority of the rule in the spec.
+	Priority int64 `json:"priority"`
+	// SrcIpRanges are the addresses the nodes were resolved to, including the held addresses.
+	SrcIpRanges []string `json:"srcIpRanges,omitempty"`
+}
+
+// HeldAddressStatus is an address of a node removed from a rule, which the rule keeps until the expiration.
+type HeldAddressStatus struct {
+	// Priority is the priority of the rule in the spec.
+	Priority int64 `json:"priority"`
+	// Address is the address of the removed node, as a /32 or /128 range.
+	Address string `json:"address"`
+	// ExpirationTime is the time the address is removed from the rule.
+	ExpirationTime metav1.Time `json:"expirationTime"`
 }
 
 // SecurityPolicyStatus defines the observed state of SecurityPolicy
 type SecurityPolicyStatus struct {
-	Name          string               `json:"name,omitempty"`
-	Description   string               `json:"description,omitempty"`
-	DefaultAction string               `json:"defaultAction,omitempty"`
-	Rules         []SecurityPolicyRule `json:"rules,omitempty"`
-	Condition     string               `json:"condition,omitempty"`
+	// ID is the unique identifier of the security policy in Cloud Armor.
+	ID string `json:"id,omitempty"`
+	// Name is the name of the security policy in Cloud Armor.
+	Name string `json:"name,omitempty"`
+	// Type is the type of the security policy in Cloud Armor.
+	Type string `json:"type,omitempty"`
+	// Region is the region of the regional security policy. It is empty for the global security policy.
+	Region      string `json:"region,omitempty"`
+	SelfLink    string `json:"selfLink,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Rules are the rules of the security policy in Cloud Armor.
+	Rules []SecurityPolicyRuleStatus `json:"rules,omitempty"`
+	// SplitRules are the rules which have more srcIpRanges than a rule of Cloud Armor allows,
+	// and are split into the rules of consecutive priorities.
+	SplitRules []SplitRuleStatus `json:"splitRules,omitempty"`
+	// AppliedNodeAddresses are the addresses of nodePoolSelectors rules the operator applied last.
+	// Changes of the nodes are told from drift by them, because Rules include the drift reported and not corrected.
+	AppliedNodeAddresses []NodeAddressesStatus `json:"appliedNodeAddresses,omitempty"`
+	// HeldAddresses are the addresses of the removed nodes the rules keep by gracePeriodSeconds of nodeFilter.
+	HeldAddresses []HeldAddressStatus `json:"heldAddresses,omitempty"`
+	// LastSyncTime is the last time the security policy was synced with Cloud Armor.
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// Conditions are Ready, Synced, NodeAddressesResolved and Degraded.
+	Conditions []SecurityPolicyCondition `json:"conditions,omitempty"`
+	// LastOperation is the name of the last Compute operation that changed the security policy.
+	LastOperation string `json:"lastOperation,omitempty"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // SecurityPolicy is the Schema for the securitypolicies API
 type SecurityPolicy struct {
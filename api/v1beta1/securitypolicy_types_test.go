@@ -1,3 +1,6 @@
+//go:build integration
+// +build integration
+
 /*
 
 Licensed under the Apache License, Version 2.0 (the "License");
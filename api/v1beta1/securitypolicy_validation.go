@@ -0,0 +1,386 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+)
+
+// preconfiguredWafNamePattern matches rule set names and signature IDs, such as sqli-v33-stable.
+// They are embedded in the evaluatePreconfiguredWaf expression.
+var preconfiguredWafNamePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Validate checks the constraints of the spec which the CRD schema can not express.
+func (s *SecurityPolicySpec) Validate() error {
+	errs := s.validateType()
+	errs = append(errs, s.validatePriorities()...)
+	for i := range s.Rules {
+		if err := s.Rules[i].Validate(); err != nil {
+			errs = append(errs, fmt.Sprintf("rules[%d]: %v", i, err))
+			continue
+		}
+		if err := s.Rules[i].validateType(s.Type); err != nil {
+			errs = append(errs, fmt.Sprintf("rules[%d]: %v", i, err))
+		}
+	}
+	if err := s.validateDefaultRule(); err != nil {
+		errs = append(errs, fmt.Sprintf("defaultRule: %v", err))
+	}
+	if s.AdaptiveProtection != nil {
+		if err := s.AdaptiveProtection.Validate(); err != nil {
+			errs = append(errs, fmt.Sprintf("adaptiveProtection: %v", err))
+		}
+	}
+	if s.AdvancedOptionsConfig != nil {
+		if err := s.AdvancedOptionsConfig.Validate(); err != nil {
+			errs = append(errs, fmt.Sprintf("advancedOptionsConfig: %v", err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid security policy: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// validatePriorities checks that the priorities of the rules are unique and leave DefaultRulePriority to the default rule.
+// Otherwise the rules collide in Cloud Armor, and only the insert of the policy fails.
+func (s *SecurityPolicySpec) validatePriorities() []string {
+	errs := []string{}
+	seen := map[int64]int{}
+	for i, rule := range s.Rules {
+		if rule.Priority >= DefaultRulePriority {
+			errs = append(errs, fmt.Sprintf("rules[%d]: priority %d is reserved for the default rule", i, rule.Priority))
+			continue
+		}
+		if j, ok := seen[rule.Priority]; ok {
+			errs = append(errs, fmt.Sprintf("rules[%d]: priority %d is already used by rules[%d]", i, rule.Priority, j))
+			continue
+		}
+		seen[rule.Priority] = i
+	}
+	return errs
+}
+
+// defaultRuleActions are the actions of the default rule, the same as the enum of the CRD schema.
+var defaultRuleActions = map[string]bool{
+	"allow": true, "deny(403)": true, "deny(404)": true, "deny(502)": true, "throttle": true, "redirect": true,
+}
+
+// validateDefaultRule checks the default rule converted by SecurityPolicyDefaultRule, the same as the other rules.
+func (s *SecurityPolicySpec) validateDefaultRule() error {
+	switch {
+	case s.DefaultAction != "" && s.DefaultRule != nil:
+		return fmt.Errorf("only one of defaultAction or defaultRule can be set")
+	case s.DefaultAction == "" && s.DefaultRule == nil:
+		return fmt.Errorf("one of defaultAction or defaultRule must be set")
+	}
+	rule := s.SecurityPolicyDefaultRule()
+	if !defaultRuleActions[rule.Action] {
+		return fmt.Errorf("%s action is not allowed for the default rule", rule.Action)
+	}
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	return rule.validateType(s.Type)
+}
+
+// validateType checks the region and the policy-level options the type of the policy supports.
+// Only CLOUD_ARMOR supports Adaptive Protection, the advanced options and reCAPTCHA.
+func (s *SecurityPolicySpec) validateType() []string {
+	errs := []string{}
+	switch s.Type {
+	case SecurityPolicyTypeCloudArmorEdge:
+		if s.Region != "" {
+			errs = append(errs, "region is not allowed for CLOUD_ARMOR_EDGE type")
+		}
+	case SecurityPolicyTypeCloudArmorNetwork:
+		if s.Region == "" {
+			errs = append(errs, "region is required for CLOUD_ARMOR_NETWORK type")
+		}
+	default:
+		return errs
+	}
+	if s.AdaptiveProtection != nil {
+		errs = append(errs, fmt.Sprintf("adaptiveProtection is not allowed for %s type", s.Type))
+	}
+	if s.AdvancedOptionsConfig != nil {
+		errs = append(errs, fmt.Sprintf("advancedOptionsConfig is not allowed for %s type", s.Type))
+	}
+	if s.RecaptchaOptionsConfig != nil {
+		errs = append(errs, fmt.Sprintf("recaptchaOptionsConfig is not allowed for %s type", s.Type))
+	}
+	return errs
+}
+
+// validateType checks that the rule uses only the matches and actions the type of the policy supports.
+// CLOUD_ARMOR_EDGE and CLOUD_ARMOR_NETWORK rules allow or deny requests by addresses, and edge rules by an expression too.
+func (r *SecurityPolicyRule) validateType(policyType SecurityPolicyType) error {
+	if policyType != SecurityPolicyTypeCloudArmorEdge && policyType != SecurityPolicyTypeCloudArmorNetwork {
+		return nil
+	}
+	if r.Action != "allow" && !strings.HasPrefix(r.Action, "deny") {
+		return fmt.Errorf("priority %d: %s action is not allowed for %s type", r.Priority, r.Action, policyType)
+	}
+	switch {
+	case r.Expression != "" && policyType == SecurityPolicyTypeCloudArmorNetwork:
+		return fmt.Errorf("priority %d: expression is not allowed for %s type", r.Priority, policyType)
+	case r.PreconfiguredWaf != nil:
+		return fmt.Errorf("priority %d: preconfiguredWaf is not allowed for %s type", r.Priority, policyType)
+	case len(r.RequestHeadersToAdd) > 0:
+		return fmt.Errorf("priority %d: requestHeadersToAdd is not allowed for %s type", r.Priority, policyType)
+	}
+	return nil
+}
+
+// Validate checks that the rule matches one of addresses, an expression or a preconfigured WAF rule set.
+func (r *SecurityPolicyRule) Validate() error {
+	matches := 0
+	if len(r.SrcIpRanges) > 0 || len(r.NodePoolSelectors) > 0 {
+		matches++
+	}
+	if r.Expression != "" {
+		matches++
+	}
+	if r.PreconfiguredWaf != nil {
+		matches++
+	}
+	switch {
+	case matches > 1:
+		return fmt.Errorf("priority %d: only one of srcIpRanges/nodePoolSelectors, expression or preconfiguredWaf can be set", r.Priority)
+	case matches == 0:
+		return fmt.Errorf("priority %d: one of srcIpRanges/nodePoolSelectors, expression or preconfiguredWaf must be set", r.Priority)
+	}
+	if r.PreconfiguredWaf != nil {
+		if err := r.PreconfiguredWaf.Validate(); err != nil {
+			return fmt.Errorf("priority %d: preconfiguredWaf: %v", r.Priority, err)
+		}
+	}
+	if err := validateRateLimitOptions(r.Action, r.RateLimitOptions); err != nil {
+		return fmt.Errorf("priority %d: %v", r.Priority, err)
+	}
+	if err := validateRedirectOptions(r.Action, r.RedirectOptions); err != nil {
+		return fmt.Errorf("priority %d: %v", r.Priority, err)
+	}
+	if err := validateRequestHeaders(r.Action, r.RequestHeadersToAdd); err != nil {
+		return fmt.Errorf("priority %d: %v", r.Priority, err)
+	}
+	if err := r.validateNodePoolSelectors(); err != nil {
+		return fmt.Errorf("priority %d: %v", r.Priority, err)
+	}
+	if r.AddressSource != nil {
+		if len(r.NodePoolSelectors) == 0 {
+			return fmt.Errorf("priority %d: addressSource requires nodePoolSelectors", r.Priority)
+		}
+		if err := r.AddressSource.Validate(); err != nil {
+			return fmt.Errorf("priority %d: addressSource: %v", r.Priority, err)
+		}
+	}
+	if r.NodeFilter != nil && len(r.NodePoolSelectors) == 0 {
+		return fmt.Errorf("priority %d: nodeFilter requires nodePoolSelectors", r.Priority)
+	}
+	return nil
+}
+
+// Validate checks that annotation and configMapKeyRef are set exactly for their types.
+func (a *AddressSource) Validate() error {
+	switch {
+	case a.Type == AddressSourceAnnotation && a.Annotation == "":
+		return fmt.Errorf("type Annotation requires annotation")
+	case a.Type != AddressSourceAnnotation && a.Annotation != "":
+		return fmt.Errorf("annotation is not allowed for type %s", a.Type)
+	case a.Type == AddressSourceConfigMap && (a.ConfigMapKeyRef == nil || a.ConfigMapKeyRef.Name == "" || a.ConfigMapKeyRef.Key == ""):
+		return fmt.Errorf("type ConfigMap requires configMapKeyRef with name and key")
+	case a.Type != AddressSourceConfigMap && a.ConfigMapKeyRef != nil:
+		return fmt.Errorf("configMapKeyRef is not allowed for type %s", a.Type)
+	}
+	return nil
+}
+
+// validateNodePoolSelectors checks that the selectors are not an empty list, that each selector sets either key and value,
+// or matchLabels and matchExpressions, and that the selectors are valid label selectors.
+func (r *SecurityPolicyRule) validateNodePoolSelectors() error {
+	if r.NodePoolSelectors != nil && len(r.NodePoolSelectors) == 0 {
+		// an empty selector would select all the nodes of the cluster.
+		return fmt.Errorf("nodePoolSelectors must not be empty")
+	}
+	for i, s := range r.NodePoolSelectors {
+		labelSelector := len(s.MatchLabels) > 0 || len(s.MatchExpressions) > 0
+		switch {
+		case s.Key == "" && s.Value != "":
+			return fmt.Errorf("nodePoolSelectors[%d]: value requires key", i)
+		case s.Key != "" && labelSelector:
+			return fmt.Errorf("nodePoolSelectors[%d]: key can not be set with matchLabels or matchExpressions", i)
+		case s.Key == "" && !labelSelector:
+			return fmt.Errorf("nodePoolSelectors[%d]: one of key, matchLabels or matchExpressions must be set", i)
+		}
+	}
+	if _, err := r.NodeSelector(); err != nil {
+		return fmt.Errorf("nodePoolSelectors: %v", err)
+	}
+	return nil
+}
+
+// validateRequestHeaders checks that headers are added only to the requests the rule passes, without duplicates.
+func validateRequestHeaders(action string, headers []RequestHeader) error {
+	if len(headers) == 0 {
+		return nil
+	}
+	if strings.HasPrefix(action, "deny") {
+		return fmt.Errorf("requestHeadersToAdd is not allowed for %s action", action)
+	}
+	names := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		name := strings.ToLower(header.Name)
+		if names[name] {
+			return fmt.Errorf("duplicate request header %q", header.Name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// Validate checks that the threshold configs have unique names, and are set only when the defense is enabled.
+func (a *AdaptiveProtection) Validate() error {
+	config := a.Layer7DdosDefenseConfig
+	if !config.Enable && len(config.ThresholdConfigs) > 0 {
+		return fmt.Errorf("layer7DdosDefenseConfig.thresholdConfigs requires enable")
+	}
+	names := make(map[string]bool, len(config.ThresholdConfigs))
+	for _, threshold := range config.ThresholdConfigs {
+		if names[threshold.Name] {
+			return fmt.Errorf("duplicate threshold config %q", threshold.Name)
+		}
+		names[threshold.Name] = true
+	}
+	return nil
+}
+
+// Validate checks that custom content types are set only for STANDARD JSON parsing, and headers are not duplicated.
+func (c *AdvancedOptionsConfig) Validate() error {
+	if c.JsonCustomConfig != nil && c.JsonParsing != "STANDARD" {
+		return fmt.Errorf("jsonCustomConfig requires STANDARD jsonParsing")
+	}
+	if c.JsonCustomConfig != nil {
+		for _, contentType := range c.JsonCustomConfig.ContentTypes {
+			if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || !strings.Contains(mediaType, "/") {
+				return fmt.Errorf("invalid content type %q", contentType)
+			}
+		}
+	}
+	names := make(map[string]bool, len(c.UserIpRequestHeaders))
+	for _, header := range c.UserIpRequestHeaders {
+		name := strings.ToLower(header)
+		if names[name] {
+			return fmt.Errorf("duplicate user IP request header %q", header)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// validateRedirectOptions checks that redirectOptions are set only for redirect action, with the target its type requires.
+func validateRedirectOptions(action string, options *RedirectOptions) error {
+	switch {
+	case action == "redirect" && options == nil:
+		return fmt.Errorf("action redirect requires redirectOptions")
+	case action != "redirect" && options != nil:
+		return fmt.Errorf("redirectOptions is allowed only for redirect action")
+	case options == nil:
+		return nil
+	}
+	switch options.Type {
+	case "EXTERNAL_302":
+		if options.Target == "" {
+			return fmt.Errorf("redirectOptions.type EXTERNAL_302 requires target")
+		}
+	case "GOOGLE_RECAPTCHA":
+		if options.Target != "" {
+			return fmt.Errorf("redirectOptions.target is not allowed for GOOGLE_RECAPTCHA")
+		}
+	}
+	return nil
+}
+
+// validateRateLimitOptions checks that rateLimitOptions are set only for throttle and rate_based_ban actions,
+// with the options the action allows.
+func validateRateLimitOptions(action string, options *RateLimitOptions) error {
+	rateLimited := action == "throttle" || action == "rate_based_ban"
+	switch {
+	case rateLimited && options == nil:
+		return fmt.Errorf("action %s requires rateLimitOptions", action)
+	case !rateLimited && options != nil:
+		return fmt.Errorf("rateLimitOptions is allowed only for throttle and rate_based_ban actions")
+	case options == nil:
+		return nil
+	}
+	if action == "rate_based_ban" && options.BanDurationSec == 0 {
+		return fmt.Errorf("action rate_based_ban requires rateLimitOptions.banDurationSec")
+	}
+	if action == "throttle" && (options.BanDurationSec != 0 || options.BanThreshold != nil) {
+		return fmt.Errorf("rateLimitOptions.banDurationSec and banThreshold are allowed only for rate_based_ban action")
+	}
+	switch options.EnforceOnKey {
+	case "HTTP_HEADER", "HTTP_COOKIE":
+		if options.EnforceOnKeyName == "" {
+			return fmt.Errorf("rateLimitOptions.enforceOnKey %s requires enforceOnKeyName", options.EnforceOnKey)
+		}
+	default:
+		if options.EnforceOnKeyName != "" {
+			return fmt.Errorf("rateLimitOptions.enforceOnKeyName is allowed only for HTTP_HEADER and HTTP_COOKIE")
+		}
+	}
+	return nil
+}
+
+// Validate checks the names embedded in the expression, and the combination of the options.
+func (w *PreconfiguredWaf) Validate() error {
+	if !preconfiguredWafNamePattern.MatchString(w.RuleSet) {
+		return fmt.Errorf("invalid ruleSet %q", w.RuleSet)
+	}
+	ids := append(append([]string{}, w.OptInRuleIDs...), w.OptOutRuleIDs...)
+	for _, exclusion := range w.Exclusions {
+		ids = append(ids, exclusion.TargetRuleIDs...)
+	}
+	for _, id := range ids {
+		if !preconfiguredWafNamePattern.MatchString(id) {
+			return fmt.Errorf("invalid rule ID %q", id)
+		}
+	}
+	if len(w.OptInRuleIDs) > 0 {
+		if len(w.OptOutRuleIDs) > 0 {
+			return fmt.Errorf("only one of optInRuleIds or optOutRuleIds can be set")
+		}
+		if w.Sensitivity == nil || *w.Sensitivity != 0 {
+			return fmt.Errorf("optInRuleIds requires sensitivity 0")
+		}
+	}
+	for _, exclusion := range w.Exclusions {
+		fields := append(append(append(append([]PreconfiguredWafExclusionField{},
+			exclusion.RequestHeaders...), exclusion.RequestCookies...), exclusion.RequestQueryParams...), exclusion.RequestUris...)
+		if len(fields) == 0 {
+			return fmt.Errorf("exclusion must have at least one request field")
+		}
+		for _, field := range fields {
+			if (field.Operator == "EQUALS_ANY") != (field.Value == "") {
+				return fmt.Errorf("exclusion operator %s with value %q: value must be empty only for EQUALS_ANY", field.Operator, field.Value)
+			}
+		}
+	}
+	return nil
+}
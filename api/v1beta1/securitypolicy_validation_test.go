@@ -0,0 +1,267 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("SecurityPolicySpec validation", func() {
+	var spec *SecurityPolicySpec
+
+	BeforeEach(func() {
+		spec = &SecurityPolicySpec{
+			Name:          "policy",
+			Description:   "description",
+			DefaultAction: "deny(403)",
+			Rules: []SecurityPolicyRule{
+				{Action: "allow", Description: "addresses", Priority: 100, SrcIpRanges: []string{"192.168.0.0/24"}},
+				{Action: "allow", Description: "nodes", Priority: 101, NodePoolSelectors: []LabelSelectors{{Key: "pool", Value: "default"}}},
+				{Action: "deny(403)", Description: "expression", Priority: 102, Expression: "origin.region_code == 'RU'"},
+			},
+		}
+	})
+
+	It("should accept rules with either addresses or an expression", func() {
+		Expect(spec.Validate()).To(Succeed())
+	})
+
+	It("should reject a rule with both addresses and an expression", func() {
+		spec.Rules[0].Expression = "request.path.matches('/admin')"
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("rules[0]: priority 100: only one of")))
+	})
+
+	It("should reject duplicate priorities and the priority of the default rule", func() {
+		spec.Rules[1].Priority = 100
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("rules[1]: priority 100 is already used by rules[0]")))
+
+		spec.Rules[1].Priority = DefaultRulePriority
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("rules[1]: priority 2147483647 is reserved for the default rule")))
+
+		spec.Rules[1].Priority = DefaultRulePriority - 1
+		Expect(spec.Validate()).To(Succeed())
+	})
+
+	It("should reject a preconfigured WAF rule with opt-in signatures out of sensitivity 0", func() {
+		sensitivity := int64(1)
+		spec.Rules[2].Expression = ""
+		spec.Rules[2].PreconfiguredWaf = &PreconfiguredWaf{
+			RuleSet:      "sqli-v33-stable",
+			Sensitivity:  &sensitivity,
+			OptInRuleIDs: []string{"owasp-crs-v030301-id942350-sqli"},
+		}
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("optInRuleIds requires sensitivity 0")))
+
+		sensitivity = 0
+		Expect(spec.Validate()).To(Succeed())
+	})
+
+	It("should reject names which can not be embedded in the expression", func() {
+		spec.Rules[2].Expression = ""
+		spec.Rules[2].PreconfiguredWaf = &PreconfiguredWaf{RuleSet: "xss-v33-stable', {}) || true || ('"}
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("invalid ruleSet")))
+	})
+
+	It("should require rateLimitOptions exactly for throttle and rate_based_ban actions", func() {
+		spec.Rules[0].Action = "throttle"
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("action throttle requires rateLimitOptions")))
+
+		spec.Rules[0].RateLimitOptions = &RateLimitOptions{
+			RateLimitThreshold: RateLimitThreshold{Count: 100, IntervalSec: 60},
+			ExceedAction:       "deny(429)",
+			EnforceOnKey:       "HTTP_HEADER",
+			EnforceOnKeyName:   "x-api-key",
+		}
+		Expect(spec.Validate()).To(Succeed())
+
+		spec.Rules[0].Action = "rate_based_ban"
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("requires rateLimitOptions.banDurationSec")))
+		spec.Rules[0].RateLimitOptions.BanDurationSec = 600
+		Expect(spec.Validate()).To(Succeed())
+
+		spec.Rules[0].Action = "allow"
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("rateLimitOptions is allowed only for")))
+	})
+
+	It("should require enforceOnKeyName only for headers and cookies", func() {
+		spec.Rules[0].Action = "throttle"
+		spec.Rules[0].RateLimitOptions = &RateLimitOptions{
+			RateLimitThreshold: RateLimitThreshold{Count: 100, IntervalSec: 60},
+			ExceedAction:       "deny(429)",
+			EnforceOnKey:       "HTTP_COOKIE",
+		}
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("requires enforceOnKeyName")))
+
+		spec.Rules[0].RateLimitOptions.EnforceOnKey = "IP"
+		spec.Rules[0].RateLimitOptions.EnforceOnKeyName = "session"
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("enforceOnKeyName is allowed only for")))
+	})
+
+	It("should require redirectOptions with the target its type requires", func() {
+		spec.Rules[2].Action = "redirect"
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("action redirect requires redirectOptions")))
+
+		spec.Rules[2].RedirectOptions = &RedirectOptions{Type: "EXTERNAL_302"}
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("EXTERNAL_302 requires target")))
+		spec.Rules[2].RedirectOptions.Target = "https://example.com/blocked"
+		Expect(spec.Validate()).To(Succeed())
+
+		spec.Rules[2].RedirectOptions.Type = "GOOGLE_RECAPTCHA"
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("target is not allowed for GOOGLE_RECAPTCHA")))
+		spec.Rules[2].RedirectOptions.Target = ""
+		Expect(spec.Validate()).To(Succeed())
+	})
+
+	It("should reject request headers for deny actions and duplicate names", func() {
+		spec.Rules[0].RequestHeadersToAdd = []RequestHeader{{Name: "X-Partner", Value: "allowlist"}}
+		Expect(spec.Validate()).To(Succeed())
+
+		spec.Rules[0].RequestHeadersToAdd = append(spec.Rules[0].RequestHeadersToAdd, RequestHeader{Name: "x-partner"})
+		Expect(spec.Validate()).To(MatchError(ContainSubstring(`duplicate request header "x-partner"`)))
+
+		spec.Rules[2].RequestHeadersToAdd = []RequestHeader{{Name: "X-Blocked"}}
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("requestHeadersToAdd is not allowed for deny(403) action")))
+	})
+
+	It("should reject threshold configs which are disabled or have duplicate names", func() {
+		spec.AdaptiveProtection = &AdaptiveProtection{Layer7DdosDefenseConfig: Layer7DdosDefenseConfig{
+			Enable:           true,
+			ThresholdConfigs: []Layer7DdosDefenseThresholdConfig{{Name: "high", AutoDeployLoadThreshold: "0.8"}},
+		}}
+		Expect(spec.Validate()).To(Succeed())
+
+		spec.AdaptiveProtection.Layer7DdosDefenseConfig.ThresholdConfigs = append(spec.AdaptiveProtection.Layer7DdosDefenseConfig.ThresholdConfigs, Layer7DdosDefenseThresholdConfig{Name: "high"})
+		Expect(spec.Validate()).To(MatchError(ContainSubstring(`adaptiveProtection: duplicate threshold config "high"`)))
+
+		spec.AdaptiveProtection.Layer7DdosDefenseConfig.Enable = false
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("thresholdConfigs requires enable")))
+	})
+
+	It("should require STANDARD jsonParsing for custom content types", func() {
+		spec.AdvancedOptionsConfig = &AdvancedOptionsConfig{
+			JsonCustomConfig:     &JsonCustomConfig{ContentTypes: []string{"application/vnd.api+json"}},
+			UserIpRequestHeaders: []string{"True-Client-IP"},
+		}
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("advancedOptionsConfig: jsonCustomConfig requires STANDARD jsonParsing")))
+
+		spec.AdvancedOptionsConfig.JsonParsing = "STANDARD"
+		Expect(spec.Validate()).To(Succeed())
+
+		spec.AdvancedOptionsConfig.JsonCustomConfig.ContentTypes = append(spec.AdvancedOptionsConfig.JsonCustomConfig.ContentTypes, "json")
+		Expect(spec.Validate()).To(MatchError(ContainSubstring(`invalid content type "json"`)))
+
+		spec.AdvancedOptionsConfig.JsonCustomConfig = nil
+		spec.AdvancedOptionsConfig.UserIpRequestHeaders = append(spec.AdvancedOptionsConfig.UserIpRequestHeaders, "true-client-ip")
+		Expect(spec.Validate()).To(MatchError(ContainSubstring(`duplicate user IP request header "true-client-ip"`)))
+	})
+
+	It("should check the region and the options the type of the policy supports", func() {
+		spec.Type = SecurityPolicyTypeCloudArmorNetwork
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("region is required for CLOUD_ARMOR_NETWORK type")))
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("rules[2]: priority 102: expression is not allowed for CLOUD_ARMOR_NETWORK type")))
+
+		spec.Type = SecurityPolicyTypeCloudArmorEdge
+		spec.Region = "asia-northeast1"
+		spec.AdaptiveProtection = &AdaptiveProtection{Layer7DdosDefenseConfig: Layer7DdosDefenseConfig{Enable: true}}
+		spec.Rules[0].RequestHeadersToAdd = []RequestHeader{{Name: "X-Partner"}}
+		err := spec.Validate()
+		Expect(err).To(MatchError(ContainSubstring("region is not allowed for CLOUD_ARMOR_EDGE type")))
+		Expect(err).To(MatchError(ContainSubstring("adaptiveProtection is not allowed for CLOUD_ARMOR_EDGE type")))
+		Expect(err).To(MatchError(ContainSubstring("rules[0]: priority 100: requestHeadersToAdd is not allowed for CLOUD_ARMOR_EDGE type")))
+
+		spec.Region = ""
+		spec.AdaptiveProtection = nil
+		spec.Rules[0].RequestHeadersToAdd = nil
+		Expect(spec.Validate()).To(Succeed())
+	})
+
+	It("should require one of defaultAction or defaultRule with the options its action requires", func() {
+		spec.DefaultAction = "allow"
+		Expect(spec.Validate()).To(Succeed())
+
+		spec.DefaultRule = &DefaultRule{Action: "throttle"}
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("defaultRule: only one of defaultAction or defaultRule can be set")))
+
+		spec.DefaultAction = ""
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("defaultRule: priority 2147483647: action throttle requires rateLimitOptions")))
+
+		spec.DefaultRule = &DefaultRule{Action: "rate_based_ban"}
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("defaultRule: rate_based_ban action is not allowed for the default rule")))
+
+		spec.DefaultRule = &DefaultRule{Action: "redirect", RedirectOptions: &RedirectOptions{Type: "GOOGLE_RECAPTCHA"}}
+		Expect(spec.Validate()).To(Succeed())
+		Expect(spec.SecurityPolicyDefaultRule().Description).To(Equal("This is default action"))
+
+		spec.DefaultRule = nil
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("defaultRule: one of defaultAction or defaultRule must be set")))
+	})
+
+	It("should reject a rule without a match", func() {
+		spec.Rules[2].Expression = ""
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("rules[2]: priority 102: one of")))
+	})
+
+	It("should accept label selectors in nodePoolSelectors with the key and value form", func() {
+		spec.Rules[1].NodePoolSelectors = append(spec.Rules[1].NodePoolSelectors, LabelSelectors{
+			LabelSelector: metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "zone", Operator: metav1.LabelSelectorOpIn, Values: []string{"a", "b"}},
+					{Key: "spot", Operator: metav1.LabelSelectorOpDoesNotExist},
+				},
+			},
+		})
+		Expect(spec.Validate()).To(Succeed())
+		selector, err := spec.Rules[1].NodeSelector()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(selector.String()).To(Equal("pool=default,!spot,zone in (a,b)"))
+
+		spec.Rules[1].NodePoolSelectors[1].MatchExpressions[0].Operator = "Gt"
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("rules[1]: priority 101: nodePoolSelectors:")))
+
+		spec.Rules[1].NodePoolSelectors[1].Key = "pool"
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("nodePoolSelectors[1]: key can not be set with matchLabels or matchExpressions")))
+	})
+
+	It("should reject an empty nodePoolSelectors", func() {
+		spec.Rules[0].NodePoolSelectors = []LabelSelectors{}
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("rules[0]: priority 100: nodePoolSelectors must not be empty")))
+	})
+
+	It("should require the options the type of addressSource needs", func() {
+		spec.Rules[1].AddressSource = &AddressSource{Type: AddressSourceAnnotation}
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("rules[1]: priority 101: addressSource: type Annotation requires annotation")))
+
+		spec.Rules[1].AddressSource.Annotation = "example.com/egress-ips"
+		Expect(spec.Validate()).To(Succeed())
+
+		spec.Rules[1].AddressSource.Type = AddressSourceConfigMap
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("annotation is not allowed for type ConfigMap")))
+
+		spec.Rules[0].AddressSource = &AddressSource{Type: AddressSourceInternalIP}
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("rules[0]: priority 100: addressSource requires nodePoolSelectors")))
+	})
+
+	It("should require nodePoolSelectors for nodeFilter", func() {
+		spec.Rules[1].NodeFilter = &NodeFilter{ReadyOnly: true, GracePeriodSeconds: 300}
+		Expect(spec.Validate()).To(Succeed())
+
+		spec.Rules[0].NodeFilter = &NodeFilter{ReadyOnly: true}
+		Expect(spec.Validate()).To(MatchError(ContainSubstring("rules[0]: priority 100: nodeFilter requires nodePoolSelectors")))
+	})
+})
@@ -20,12 +20,136 @@ limitations under the License.
 package v1beta1
 
 import (
+	"k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdaptiveProtection) DeepCopyInto(out *AdaptiveProtection) {
+	*out = *in
+	in.Layer7DdosDefenseConfig.DeepCopyInto(&out.Layer7DdosDefenseConfig)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdaptiveProtection.
+func (in *AdaptiveProtection) DeepCopy() *AdaptiveProtection {
+	if in == nil {
+		return nil
+	}
+	out := new(AdaptiveProtection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AddressSource) DeepCopyInto(out *AddressSource) {
+	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(v1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AddressSource.
+func (in *AddressSource) DeepCopy() *AddressSource {
+	if in == nil {
+		return nil
+	}
+	out := new(AddressSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdvancedOptionsConfig) DeepCopyInto(out *AdvancedOptionsConfig) {
+	*out = *in
+	if in.JsonCustomConfig != nil {
+		in, out := &in.JsonCustomConfig, &out.JsonCustomConfig
+		*out = new(JsonCustomConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UserIpRequestHeaders != nil {
+		in, out := &in.UserIpRequestHeaders, &out.UserIpRequestHeaders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdvancedOptionsConfig.
+func (in *AdvancedOptionsConfig) DeepCopy() *AdvancedOptionsConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AdvancedOptionsConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DefaultRule) DeepCopyInto(out *DefaultRule) {
+	*out = *in
+	if in.RateLimitOptions != nil {
+		in, out := &in.RateLimitOptions, &out.RateLimitOptions
+		*out = new(RateLimitOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RedirectOptions != nil {
+		in, out := &in.RedirectOptions, &out.RedirectOptions
+		*out = new(RedirectOptions)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DefaultRule.
+func (in *DefaultRule) DeepCopy() *DefaultRule {
+	if in == nil {
+		return nil
+	}
+	out := new(DefaultRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HeldAddressStatus) DeepCopyInto(out *HeldAddressStatus) {
+	*out = *in
+	in.ExpirationTime.DeepCopyInto(&out.ExpirationTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HeldAddressStatus.
+func (in *HeldAddressStatus) DeepCopy() *HeldAddressStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(HeldAddressStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JsonCustomConfig) DeepCopyInto(out *JsonCustomConfig) {
+	*out = *in
+	if in.ContentTypes != nil {
+		in, out := &in.ContentTypes, &out.ContentTypes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JsonCustomConfig.
+func (in *JsonCustomConfig) DeepCopy() *JsonCustomConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(JsonCustomConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LabelSelectors) DeepCopyInto(out *LabelSelectors) {
 	*out = *in
+	in.LabelSelector.DeepCopyInto(&out.LabelSelector)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LabelSelectors.
@@ -38,6 +162,249 @@ func (in *LabelSelectors) DeepCopy() *LabelSelectors {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Layer7DdosDefenseConfig) DeepCopyInto(out *Layer7DdosDefenseConfig) {
+	*out = *in
+	if in.ThresholdConfigs != nil {
+		in, out := &in.ThresholdConfigs, &out.ThresholdConfigs
+		*out = make([]Layer7DdosDefenseThresholdConfig, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Layer7DdosDefenseConfig.
+func (in *Layer7DdosDefenseConfig) DeepCopy() *Layer7DdosDefenseConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(Layer7DdosDefenseConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Layer7DdosDefenseThresholdConfig) DeepCopyInto(out *Layer7DdosDefenseThresholdConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Layer7DdosDefenseThresholdConfig.
+func (in *Layer7DdosDefenseThresholdConfig) DeepCopy() *Layer7DdosDefenseThresholdConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(Layer7DdosDefenseThresholdConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeAddressesStatus) DeepCopyInto(out *NodeAddressesStatus) {
+	*out = *in
+	if in.SrcIpRanges != nil {
+		in, out := &in.SrcIpRanges, &out.SrcIpRanges
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeAddressesStatus.
+func (in *NodeAddressesStatus) DeepCopy() *NodeAddressesStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeAddressesStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeFilter) DeepCopyInto(out *NodeFilter) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeFilter.
+func (in *NodeFilter) DeepCopy() *NodeFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeFilter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreconfiguredWaf) DeepCopyInto(out *PreconfiguredWaf) {
+	*out = *in
+	if in.Sensitivity != nil {
+		in, out := &in.Sensitivity, &out.Sensitivity
+		*out = new(int64)
+		**out = **in
+	}
+	if in.OptInRuleIDs != nil {
+		in, out := &in.OptInRuleIDs, &out.OptInRuleIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.OptOutRuleIDs != nil {
+		in, out := &in.OptOutRuleIDs, &out.OptOutRuleIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Exclusions != nil {
+		in, out := &in.Exclusions, &out.Exclusions
+		*out = make([]PreconfiguredWafExclusion, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreconfiguredWaf.
+func (in *PreconfiguredWaf) DeepCopy() *PreconfiguredWaf {
+	if in == nil {
+		return nil
+	}
+	out := new(PreconfiguredWaf)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreconfiguredWafExclusion) DeepCopyInto(out *PreconfiguredWafExclusion) {
+	*out = *in
+	if in.TargetRuleIDs != nil {
+		in, out := &in.TargetRuleIDs, &out.TargetRuleIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RequestHeaders != nil {
+		in, out := &in.RequestHeaders, &out.RequestHeaders
+		*out = make([]PreconfiguredWafExclusionField, len(*in))
+		copy(*out, *in)
+	}
+	if in.RequestCookies != nil {
+		in, out := &in.RequestCookies, &out.RequestCookies
+		*out = make([]PreconfiguredWafExclusionField, len(*in))
+		copy(*out, *in)
+	}
+	if in.RequestQueryParams != nil {
+		in, out := &in.RequestQueryParams, &out.RequestQueryParams
+		*out = make([]PreconfiguredWafExclusionField, len(*in))
+		copy(*out, *in)
+	}
+	if in.RequestUris != nil {
+		in, out := &in.RequestUris, &out.RequestUris
+		*out = make([]PreconfiguredWafExclusionField, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreconfiguredWafExclusion.
+func (in *PreconfiguredWafExclusion) DeepCopy() *PreconfiguredWafExclusion {
+	if in == nil {
+		return nil
+	}
+	out := new(PreconfiguredWafExclusion)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreconfiguredWafExclusionField) DeepCopyInto(out *PreconfiguredWafExclusionField) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreconfiguredWafExclusionField.
+func (in *PreconfiguredWafExclusionField) DeepCopy() *PreconfiguredWafExclusionField {
+	if in == nil {
+		return nil
+	}
+	out := new(PreconfiguredWafExclusionField)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RateLimitOptions) DeepCopyInto(out *RateLimitOptions) {
+	*out = *in
+	out.RateLimitThreshold = in.RateLimitThreshold
+	if in.BanThreshold != nil {
+		in, out := &in.BanThreshold, &out.BanThreshold
+		*out = new(RateLimitThreshold)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RateLimitOptions.
+func (in *RateLimitOptions) DeepCopy() *RateLimitOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(RateLimitOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RateLimitThreshold) DeepCopyInto(out *RateLimitThreshold) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RateLimitThreshold.
+func (in *RateLimitThreshold) DeepCopy() *RateLimitThreshold {
+	if in == nil {
+		return nil
+	}
+	out := new(RateLimitThreshold)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RecaptchaOptionsConfig) DeepCopyInto(out *RecaptchaOptionsConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RecaptchaOptionsConfig.
+func (in *RecaptchaOptionsConfig) DeepCopy() *RecaptchaOptionsConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RecaptchaOptionsConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedirectOptions) DeepCopyInto(out *RedirectOptions) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedirectOptions.
+func (in *RedirectOptions) DeepCopy() *RedirectOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(RedirectOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RequestHeader) DeepCopyInto(out *RequestHeader) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RequestHeader.
+func (in *RequestHeader) DeepCopy() *RequestHeader {
+	if in == nil {
+		return nil
+	}
+	out := new(RequestHeader)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecurityPolicy) DeepCopyInto(out *SecurityPolicy) {
 	*out = *in
@@ -65,6 +432,22 @@ func (in *SecurityPolicy) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecurityPolicyCondition) DeepCopyInto(out *SecurityPolicyCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecurityPolicyCondition.
+func (in *SecurityPolicyCondition) DeepCopy() *SecurityPolicyCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(SecurityPolicyCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecurityPolicyList) DeepCopyInto(out *SecurityPolicyList) {
 	*out = *in
@@ -108,6 +491,38 @@ func (in *SecurityPolicyRule) DeepCopyInto(out *SecurityPolicyRule) {
 	if in.NodePoolSelectors != nil {
 		in, out := &in.NodePoolSelectors, &out.NodePoolSelectors
 		*out = make([]LabelSelectors, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AddressSource != nil {
+		in, out := &in.AddressSource, &out.AddressSource
+		*out = new(AddressSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeFilter != nil {
+		in, out := &in.NodeFilter, &out.NodeFilter
+		*out = new(NodeFilter)
+		**out = **in
+	}
+	if in.PreconfiguredWaf != nil {
+		in, out := &in.PreconfiguredWaf, &out.PreconfiguredWaf
+		*out = new(PreconfiguredWaf)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RateLimitOptions != nil {
+		in, out := &in.RateLimitOptions, &out.RateLimitOptions
+		*out = new(RateLimitOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RedirectOptions != nil {
+		in, out := &in.RedirectOptions, &out.RedirectOptions
+		*out = new(RedirectOptions)
+		**out = **in
+	}
+	if in.RequestHeadersToAdd != nil {
+		in, out := &in.RequestHeadersToAdd, &out.RequestHeadersToAdd
+		*out = make([]RequestHeader, len(*in))
 		copy(*out, *in)
 	}
 }
@@ -122,9 +537,34 @@ func (in *SecurityPolicyRule) DeepCopy() *SecurityPolicyRule {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecurityPolicyRuleStatus) DeepCopyInto(out *SecurityPolicyRuleStatus) {
+	*out = *in
+	if in.SrcIpRanges != nil {
+		in, out := &in.SrcIpRanges, &out.SrcIpRanges
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecurityPolicyRuleStatus.
+func (in *SecurityPolicyRuleStatus) DeepCopy() *SecurityPolicyRuleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SecurityPolicyRuleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecurityPolicySpec) DeepCopyInto(out *SecurityPolicySpec) {
 	*out = *in
+	if in.DefaultRule != nil {
+		in, out := &in.DefaultRule, &out.DefaultRule
+		*out = new(DefaultRule)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Rules != nil {
 		in, out := &in.Rules, &out.Rules
 		*out = make([]SecurityPolicyRule, len(*in))
@@ -132,6 +572,21 @@ func (in *SecurityPolicySpec) DeepCopyInto(out *SecurityPolicySpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.RecaptchaOptionsConfig != nil {
+		in, out := &in.RecaptchaOptionsConfig, &out.RecaptchaOptionsConfig
+		*out = new(RecaptchaOptionsConfig)
+		**out = **in
+	}
+	if in.AdaptiveProtection != nil {
+		in, out := &in.AdaptiveProtection, &out.AdaptiveProtection
+		*out = new(AdaptiveProtection)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AdvancedOptionsConfig != nil {
+		in, out := &in.AdvancedOptionsConfig, &out.AdvancedOptionsConfig
+		*out = new(AdvancedOptionsConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecurityPolicySpec.
@@ -149,7 +604,39 @@ func (in *SecurityPolicyStatus) DeepCopyInto(out *SecurityPolicyStatus) {
 	*out = *in
 	if in.Rules != nil {
 		in, out := &in.Rules, &out.Rules
-		*out = make([]SecurityPolicyRule, len(*in))
+		*out = make([]SecurityPolicyRuleStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SplitRules != nil {
+		in, out := &in.SplitRules, &out.SplitRules
+		*out = make([]SplitRuleStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AppliedNodeAddresses != nil {
+		in, out := &in.AppliedNodeAddresses, &out.AppliedNodeAddresses
+		*out = make([]NodeAddressesStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.HeldAddresses != nil {
+		in, out := &in.HeldAddresses, &out.HeldAddresses
+		*out = make([]HeldAddressStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastSyncTime != nil {
+		in, out := &in.LastSyncTime, &out.LastSyncTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]SecurityPolicyCondition, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
@@ -165,3 +652,23 @@ func (in *SecurityPolicyStatus) DeepCopy() *SecurityPolicyStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SplitRuleStatus) DeepCopyInto(out *SplitRuleStatus) {
+	*out = *in
+	if in.Priorities != nil {
+		in, out := &in.Priorities, &out.Priorities
+		*out = make([]int64, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SplitRuleStatus.
+func (in *SplitRuleStatus) DeepCopy() *SplitRuleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SplitRuleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,109 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+	"time"
+
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// holdAddresses keeps the addresses of the nodes removed from the rules with gracePeriodSeconds of nodeFilter
+// in the desired rules until they expire. The removed addresses are the addresses the operator applied to the rule
+// last, or held already, which the nodes no longer have.
+// It returns the held addresses for status, which keep the expiration of the first reconcile they were held by.
+// The expired addresses are removed from the desired rules, but stay in status until an apply without them
+// succeeds, so that an address still applied is not held again after a failed apply.
+func holdAddresses(status *cloudarmorv1beta1.SecurityPolicyStatus, desired *cloudarmorv1beta1.SecurityPolicySpec, now time.Time) []cloudarmorv1beta1.HeldAddressStatus {
+	expirations := map[int64]map[string]metav1.Time{}
+	for _, held := range status.HeldAddresses {
+		if expirations[held.Priority] == nil {
+			expirations[held.Priority] = map[string]metav1.Time{}
+		}
+		expirations[held.Priority][held.Address] = held.ExpirationTime
+	}
+
+	var result []cloudarmorv1beta1.HeldAddressStatus
+	for i, rule := range desired.Rules {
+		if len(rule.NodePoolSelectors) == 0 || rule.NodeFilter == nil || rule.NodeFilter.GracePeriodSeconds == 0 {
+			continue
+		}
+		grace := time.Duration(rule.NodeFilter.GracePeriodSeconds) * time.Second
+		current := make(map[string]bool, len(rule.SrcIpRanges))
+		for _, address := range rule.SrcIpRanges {
+			current[address] = true
+		}
+		removed := appliedAddresses(status, rule.Priority)
+		for address := range expirations[rule.Priority] {
+			removed = append(removed, address)
+		}
+		for _, address := range canonicalIPRanges(removed) {
+			if current[address] {
+				continue
+			}
+			expiration, ok := expirations[rule.Priority][address]
+			if !ok {
+				expiration = metav1.NewTime(now.Add(grace))
+			}
+			result = append(result, cloudarmorv1beta1.HeldAddressStatus{Priority: rule.Priority, Address: address, ExpirationTime: expiration})
+			if now.Before(expiration.Time) {
+				desired.Rules[i].SrcIpRanges = append(desired.Rules[i].SrcIpRanges, address)
+			}
+		}
+		sort.Strings(desired.Rules[i].SrcIpRanges)
+	}
+	return result
+}
+
+// unexpiredAddresses returns the held addresses which are not expired at now.
+// The expired addresses are dropped once the rules without them are applied.
+func unexpiredAddresses(held []cloudarmorv1beta1.HeldAddressStatus, now time.Time) []cloudarmorv1beta1.HeldAddressStatus {
+	var result []cloudarmorv1beta1.HeldAddressStatus
+	for _, h := range held {
+		if now.Before(h.ExpirationTime.Time) {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+// appliedAddresses returns the addresses the operator applied to the rule of priority last.
+func appliedAddresses(status *cloudarmorv1beta1.SecurityPolicyStatus, priority int64) []string {
+	for _, addresses := range status.AppliedNodeAddresses {
+		if addresses.Priority == priority {
+			return addresses.SrcIpRanges
+		}
+	}
+	return nil
+}
+
+// requeueAfter returns the interval, or the duration until the first held address expires if it is earlier.
+// Zero interval is no resync. The expired addresses are left to the interval.
+func requeueAfter(held []cloudarmorv1beta1.HeldAddressStatus, interval time.Duration, now time.Time) time.Duration {
+	result := interval
+	for _, h := range unexpiredAddresses(held, now) {
+		d := h.ExpirationTime.Sub(now)
+		if d < time.Second {
+			d = time.Second
+		}
+		if result == 0 || d < result {
+			result = d
+		}
+	}
+	return result
+}
@@ -0,0 +1,99 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("holdAddresses", func() {
+	var (
+		status  *cloudarmorv1beta1.SecurityPolicyStatus
+		desired *cloudarmorv1beta1.SecurityPolicySpec
+		now     time.Time
+	)
+
+	BeforeEach(func() {
+		now = time.Unix(1000, 0)
+		status = &cloudarmorv1beta1.SecurityPolicyStatus{
+			AppliedNodeAddresses: []cloudarmorv1beta1.NodeAddressesStatus{
+				{Priority: 100, SrcIpRanges: []string{"203.0.113.1/32", "203.0.113.2/32"}},
+			},
+		}
+		desired = &cloudarmorv1beta1.SecurityPolicySpec{
+			Rules: []cloudarmorv1beta1.SecurityPolicyRule{{
+				Action:            "allow",
+				Priority:          100,
+				NodePoolSelectors: []cloudarmorv1beta1.LabelSelectors{{Key: "pool", Value: "default"}},
+				NodeFilter:        &cloudarmorv1beta1.NodeFilter{ReadyOnly: true, GracePeriodSeconds: 60},
+				SrcIpRanges:       []string{"203.0.113.1/32"},
+			}},
+		}
+	})
+
+	It("should hold the address of a removed node for the grace period", func() {
+		held := holdAddresses(status, desired, now)
+		expiration := metav1.NewTime(now.Add(60 * time.Second))
+		Expect(held).To(Equal([]cloudarmorv1beta1.HeldAddressStatus{{Priority: 100, Address: "203.0.113.2/32", ExpirationTime: expiration}}))
+		Expect(desired.Rules[0].SrcIpRanges).To(Equal([]string{"203.0.113.1/32", "203.0.113.2/32"}))
+		Expect(requeueAfter(held, 10*time.Minute, now)).To(Equal(60 * time.Second))
+	})
+
+	It("should keep the first expiration, and remove the address when it expires", func() {
+		status.HeldAddresses = []cloudarmorv1beta1.HeldAddressStatus{
+			{Priority: 100, Address: "203.0.113.2/32", ExpirationTime: metav1.NewTime(now.Add(30 * time.Second))},
+		}
+		held := holdAddresses(status, desired.DeepCopy(), now)
+		Expect(held[0].ExpirationTime.Time).To(Equal(now.Add(30 * time.Second)))
+
+		held = holdAddresses(status, desired, now.Add(30*time.Second))
+		Expect(desired.Rules[0].SrcIpRanges).To(Equal([]string{"203.0.113.1/32"}))
+		Expect(unexpiredAddresses(held, now.Add(30*time.Second))).To(BeEmpty())
+	})
+
+	It("should keep an expired address until the rules without it are applied", func() {
+		status.HeldAddresses = []cloudarmorv1beta1.HeldAddressStatus{
+			{Priority: 100, Address: "203.0.113.2/32", ExpirationTime: metav1.NewTime(now)},
+		}
+		// the apply failed, so the expired address is still in AppliedNodeAddresses.
+		later := now.Add(30 * time.Second)
+		held := holdAddresses(status, desired, later)
+		Expect(held).To(Equal(status.HeldAddresses))
+		Expect(desired.Rules[0].SrcIpRanges).To(Equal([]string{"203.0.113.1/32"}))
+		Expect(requeueAfter(held, 10*time.Minute, later)).To(Equal(10 * time.Minute))
+	})
+
+	It("should release the address of a node which comes back", func() {
+		status.HeldAddresses = []cloudarmorv1beta1.HeldAddressStatus{
+			{Priority: 100, Address: "203.0.113.2/32", ExpirationTime: metav1.NewTime(now.Add(30 * time.Second))},
+		}
+		desired.Rules[0].SrcIpRanges = []string{"203.0.113.1/32", "203.0.113.2/32"}
+		Expect(holdAddresses(status, desired, now)).To(BeEmpty())
+		Expect(desired.Rules[0].SrcIpRanges).To(HaveLen(2))
+	})
+
+	It("should not hold the addresses without the grace period", func() {
+		desired.Rules[0].NodeFilter.GracePeriodSeconds = 0
+		Expect(holdAddresses(status, desired, now)).To(BeEmpty())
+		Expect(desired.Rules[0].SrcIpRanges).To(Equal([]string{"203.0.113.1/32"}))
+	})
+})
@@ -0,0 +1,54 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// ConfigMapEventPredicate passes the ConfigMap events which can change the addresses of addressSource.
+type ConfigMapEventPredicate struct {
+}
+
+// Create returns true if the Create event should be processed
+func (p *ConfigMapEventPredicate) Create(event.CreateEvent) bool {
+	return true
+}
+
+// Delete returns true if the Delete event should be processed
+func (p *ConfigMapEventPredicate) Delete(event.DeleteEvent) bool {
+	return true
+}
+
+// Update returns true if the data of the ConfigMap changed, where addressSource reads the addresses from.
+// Resyncs and changes of the labels or annotations are filtered out.
+func (p *ConfigMapEventPredicate) Update(e event.UpdateEvent) bool {
+	oldConfigMap, ok := e.ObjectOld.(*corev1.ConfigMap)
+	if !ok {
+		return false
+	}
+	newConfigMap, ok := e.ObjectNew.(*corev1.ConfigMap)
+	if !ok {
+		return false
+	}
+	return !labelsEqual(oldConfigMap.Data, newConfigMap.Data)
+}
+
+// Generic returns true if the Generic event should be processed
+func (p *ConfigMapEventPredicate) Generic(event.GenericEvent) bool {
+	return false
+}
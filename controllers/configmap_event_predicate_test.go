@@ -0,0 +1,62 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("ConfigMapEventPredicate", func() {
+	var (
+		predicate    *ConfigMapEventPredicate
+		oldConfigMap *corev1.ConfigMap
+	)
+
+	BeforeEach(func() {
+		predicate = &ConfigMapEventPredicate{}
+		oldConfigMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "cloud-nat", Namespace: "default", ResourceVersion: "1"},
+			Data:       map[string]string{"ips": "203.0.113.1,203.0.113.2"},
+		}
+	})
+
+	update := func(newConfigMap *corev1.ConfigMap) bool {
+		return predicate.Update(event.UpdateEvent{MetaOld: oldConfigMap, ObjectOld: oldConfigMap, MetaNew: newConfigMap, ObjectNew: newConfigMap})
+	}
+
+	It("should filter out resyncs and changes of the metadata", func() {
+		Expect(update(oldConfigMap.DeepCopy())).To(BeFalse())
+
+		newConfigMap := oldConfigMap.DeepCopy()
+		newConfigMap.ResourceVersion = "2"
+		newConfigMap.Annotations = map[string]string{"owner": "network-team"}
+		Expect(update(newConfigMap)).To(BeFalse())
+	})
+
+	It("should pass a change of the data", func() {
+		newConfigMap := oldConfigMap.DeepCopy()
+		newConfigMap.Data["ips"] = "203.0.113.1"
+		Expect(update(newConfigMap)).To(BeTrue())
+
+		newConfigMap.Data = nil
+		Expect(update(newConfigMap)).To(BeTrue())
+	})
+})
@@ -0,0 +1,82 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// configMapNameIndex is the field index of SecurityPolicy by the ConfigMaps its addressSource reads.
+const configMapNameIndex = "spec.rules.addressSource.configMapKeyRef.name"
+
+// SecurityPolicyConfigMapMapper maps ConfigMap events to the security policies which read the ConfigMap.
+type SecurityPolicyConfigMapMapper struct {
+	client.Client
+	Log logr.Logger
+}
+
+// Map returns the requests of the security policies in the namespace of the ConfigMap
+// whose addressSource refers to it.
+func (m *SecurityPolicyConfigMapMapper) Map(obj handler.MapObject) []reconcile.Request {
+	ctx := context.Background()
+	namespace, name := obj.Meta.GetNamespace(), obj.Meta.GetName()
+
+	policies := &cloudarmorv1beta1.SecurityPolicyList{}
+	if err := m.List(ctx, policies, client.InNamespace(namespace), client.MatchingField(configMapNameIndex, name)); err != nil {
+		m.Log.Error(err, "unable to list security policies", "configMap", types.NamespacedName{Namespace: namespace, Name: name})
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, policy := range policies.Items {
+		if policy.Namespace != namespace || !containsString(configMapNames(&policy.Spec), name) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: policy.Namespace, Name: policy.Name}})
+	}
+	return requests
+}
+
+// indexConfigMapNames returns the names of the ConfigMaps of addressSource for configMapNameIndex.
+func indexConfigMapNames(obj runtime.Object) []string {
+	policy, ok := obj.(*cloudarmorv1beta1.SecurityPolicy)
+	if !ok {
+		return nil
+	}
+	return configMapNames(&policy.Spec)
+}
+
+// configMapNames returns the names of the ConfigMaps the nodePoolSelectors rules of spec read their addresses from.
+func configMapNames(spec *cloudarmorv1beta1.SecurityPolicySpec) []string {
+	var names []string
+	for _, rule := range spec.Rules {
+		source := rule.AddressSource
+		if len(rule.NodePoolSelectors) == 0 || source == nil || source.Type != cloudarmorv1beta1.AddressSourceConfigMap || source.ConfigMapKeyRef == nil {
+			continue
+		}
+		if !containsString(names, source.ConfigMapKeyRef.Name) {
+			names = append(names, source.ConfigMapKeyRef.Name)
+		}
+	}
+	return names
+}
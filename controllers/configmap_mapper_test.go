@@ -0,0 +1,95 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("SecurityPolicyConfigMapMapper", func() {
+	newPolicy := func(namespace, name string, configMaps ...string) *cloudarmorv1beta1.SecurityPolicy {
+		policy := &cloudarmorv1beta1.SecurityPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: cloudarmorv1beta1.SecurityPolicySpec{
+				Rules: []cloudarmorv1beta1.SecurityPolicyRule{
+					{Action: "allow", Priority: 100, SrcIpRanges: []string{"192.168.0.0/24"}},
+				},
+			},
+		}
+		for i, configMap := range configMaps {
+			policy.Spec.Rules = append(policy.Spec.Rules, cloudarmorv1beta1.SecurityPolicyRule{
+				Action:            "allow",
+				Priority:          int64(101 + i),
+				NodePoolSelectors: []cloudarmorv1beta1.LabelSelectors{{Key: "pool", Value: "default"}},
+				AddressSource: &cloudarmorv1beta1.AddressSource{
+					Type: cloudarmorv1beta1.AddressSourceConfigMap,
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: configMap},
+						Key:                  "ips",
+					},
+				},
+			})
+		}
+		return policy
+	}
+
+	It("should index the ConfigMaps of addressSource once", func() {
+		policy := newPolicy("default", "nat", "cloud-nat", "cloud-nat", "other-nat")
+		policy.Spec.Rules = append(policy.Spec.Rules, cloudarmorv1beta1.SecurityPolicyRule{
+			Action:            "allow",
+			Priority:          200,
+			NodePoolSelectors: []cloudarmorv1beta1.LabelSelectors{{Key: "pool", Value: "default"}},
+			AddressSource:     &cloudarmorv1beta1.AddressSource{Type: cloudarmorv1beta1.AddressSourceExternalIP},
+		})
+		Expect(indexConfigMapNames(policy)).To(Equal([]string{"cloud-nat", "other-nat"}))
+		Expect(indexConfigMapNames(newPolicy("default", "plain"))).To(BeEmpty())
+	})
+
+	It("should map a ConfigMap to the policies reading it in its namespace", func() {
+		Expect(cloudarmorv1beta1.AddToScheme(scheme.Scheme)).To(Succeed())
+		mapper := &SecurityPolicyConfigMapMapper{
+			Client: &indexedClient{
+				Client: fake.NewFakeClientWithScheme(scheme.Scheme,
+					newPolicy("default", "nat", "cloud-nat"),
+					newPolicy("default", "other", "other-nat"),
+					newPolicy("default", "plain"),
+					newPolicy("team-a", "nat", "cloud-nat"),
+				),
+				indexes: map[string]client.IndexerFunc{configMapNameIndex: indexConfigMapNames},
+			},
+			Log: logf.Log,
+		}
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cloud-nat", Namespace: "default"}}
+		Expect(mapper.Map(handler.MapObject{Meta: configMap, Object: configMap})).To(Equal([]reconcile.Request{
+			{NamespacedName: types.NamespacedName{Namespace: "default", Name: "nat"}},
+		}))
+
+		configMap = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "unused", Namespace: "default"}}
+		Expect(mapper.Map(handler.MapObject{Meta: configMap, Object: configMap})).To(BeEmpty())
+	})
+})
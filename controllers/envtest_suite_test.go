@@ -0,0 +1,110 @@
+//go:build integration
+// +build integration
+
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	"github.com/h-r-k-matsumoto/security-policy-operator/internal/computetest"
+	"google.golang.org/api/option"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	// +kubebuilder:scaffold:imports
+)
+
+// The specs of this file and securitypolicy_controller_test.go need the binaries of envtest,
+// and are built only with the integration tag. The other specs of the suite run offline.
+
+var cfg *rest.Config
+var k8sClient client.Client
+var testEnv *envtest.Environment
+var computeServer *computetest.Server
+var stopManager chan struct{}
+
+var _ = BeforeSuite(func(done Done) {
+	logf.SetLogger(zap.LoggerTo(GinkgoWriter, true))
+
+	By("bootstrapping test environment")
+	testEnv = &envtest.Environment{
+		CRDDirectoryPaths: []string{filepath.Join("..", "config", "crd", "bases")},
+	}
+
+	var err error
+	cfg, err = testEnv.Start()
+	Expect(err).ToNot(HaveOccurred())
+	Expect(cfg).ToNot(BeNil())
+
+	err = cloudarmorv1beta1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
+	// +kubebuilder:scaffold:scheme
+
+	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(k8sClient).ToNot(BeNil())
+
+	By("starting the compute API stand-in")
+	computeServer = computetest.NewServer()
+	backend, err := NewGCESecurityPolicyBackend(context.Background(), testProjectID,
+		option.WithEndpoint(computeServer.Endpoint()), option.WithoutAuthentication())
+	Expect(err).ToNot(HaveOccurred())
+
+	By("starting the manager")
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{Scheme: scheme.Scheme, MetricsBindAddress: "0"})
+	Expect(err).ToNot(HaveOccurred())
+	err = (&SecurityPolicyReconciler{
+		Client:         mgr.GetClient(),
+		Log:            logf.Log.WithName("controllers").WithName("SecurityPolicy"),
+		Backend:        backend,
+		Recorder:       mgr.GetEventRecorderFor("securitypolicy-controller"),
+		ResyncInterval: time.Second,
+	}).SetupWithManager(mgr)
+	Expect(err).ToNot(HaveOccurred())
+
+	stopManager = make(chan struct{})
+	go func() {
+		defer GinkgoRecover()
+		Expect(mgr.Start(stopManager)).To(Succeed())
+	}()
+
+	close(done)
+}, 60)
+
+var _ = AfterSuite(func() {
+	By("tearing down the test environment")
+	if stopManager != nil {
+		close(stopManager)
+	}
+	if computeServer != nil {
+		computeServer.Close()
+	}
+	err := testEnv.Stop()
+	Expect(err).ToNot(HaveOccurred())
+})
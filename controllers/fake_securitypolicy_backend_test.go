@@ -0,0 +1,370 @@
+/*
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// FakeSecurityPolicyBackend is in-memory SecurityPolicyBackend for tests.
+// It keeps fingerprints, rule priorities and 404 semantics close to the Compute API.
+type FakeSecurityPolicyBackend struct {
+	mu            sync.Mutex
+	region        string
+	policies      map[string]*compute.SecurityPolicy
+	operations    []*compute.Operation
+	sequence      uint64
+	nextOperation *compute.OperationError
+	// global is the backend of the global policies, which keeps the regional backends.
+	global  *FakeSecurityPolicyBackend
+	regions map[string]*FakeSecurityPolicyBackend
+}
+
+// NewFakeSecurityPolicyBackend returns empty FakeSecurityPolicyBackend of the global policies.
+func NewFakeSecurityPolicyBackend() *FakeSecurityPolicyBackend {
+	return &FakeSecurityPolicyBackend{
+		policies: map[string]*compute.SecurityPolicy{},
+		regions:  map[string]*FakeSecurityPolicyBackend{},
+	}
+}
+
+// InRegion returns the backend of the policies in region. It is created empty on the first call.
+func (f *FakeSecurityPolicyBackend) InRegion(region string) SecurityPolicyBackend {
+	global := f
+	if f.global != nil {
+		global = f.global
+	}
+	if region == "" {
+		return global
+	}
+	global.mu.Lock()
+	defer global.mu.Unlock()
+
+	regional, ok := global.regions[region]
+	if !ok {
+		regional = &FakeSecurityPolicyBackend{
+			region:   region,
+			policies: map[string]*compute.SecurityPolicy{},
+			global:   global,
+		}
+		global.regions[region] = regional
+	}
+	return regional
+}
+
+// scope returns the path of the policies, such as projects/fake/global.
+func (f *FakeSecurityPolicyBackend) scope() string {
+	if f.region != "" {
+		return "projects/fake/regions/" + f.region
+	}
+	return "projects/fake/global"
+}
+
+// Operations returns the operations recorded so far.
+func (f *FakeSecurityPolicyBackend) Operations() []*compute.Operation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]*compute.Operation{}, f.operations...)
+}
+
+// FailNextOperation makes the next mutation return an operation finished with the error.
+func (f *FakeSecurityPolicyBackend) FailNextOperation(code, message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextOperation = &compute.OperationError{
+		Errors: []*compute.OperationErrorErrors{{Code: code, Message: message}},
+	}
+}
+
+// GetOperation returns the recorded operation.
+func (f *FakeSecurityPolicyBackend) GetOperation(ctx context.Context, name string) (*compute.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, op := range f.operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("The resource '%s/operations/%s' was not found", f.scope(), name)}
+}
+
+// Get returns a copy of the stored policy.
+func (f *FakeSecurityPolicyBackend) Get(ctx context.Context, name string) (*compute.SecurityPolicy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	policy, ok := f.policies[name]
+	if !ok {
+		return nil, policyNotFoundError(f.scope(), name)
+	}
+	return copySecurityPolicy(policy), nil
+}
+
+// Insert stores the policy. The default rule is added when it is missing, as the Compute API does.
+func (f *FakeSecurityPolicyBackend) Insert(ctx context.Context, policy *compute.SecurityPolicy) (*compute.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.policies[policy.Name]; ok {
+		return nil, &googleapi.Error{Code: http.StatusConflict, Message: fmt.Sprintf("The resource '%s' already exists", policy.Name)}
+	}
+	stored := copySecurityPolicy(policy)
+	priorities := map[int64]bool{}
+	for _, rule := range stored.Rules {
+		if priorities[rule.Priority] {
+			return nil, invalidPriorityError(rule.Priority)
+		}
+		priorities[rule.Priority] = true
+	}
+	if !priorities[2147483647] {
+		stored.Rules = append(stored.Rules, &compute.SecurityPolicyRule{
+			Action:      "allow",
+			Description: "default rule",
+			Priority:    2147483647,
+			Match: &compute.SecurityPolicyRuleMatcher{
+				VersionedExpr: "SRC_IPS_V1",
+				Config:        &compute.SecurityPolicyRuleMatcherConfig{SrcIpRanges: []string{"*"}},
+			},
+		})
+	}
+	f.sequence++
+	stored.Id = f.sequence
+	stored.Kind = "compute#securityPolicy"
+	stored.SelfLink = f.scope() + "/securityPolicies/" + stored.Name
+	if f.region != "" {
+		stored.Region = "projects/fake/regions/" + f.region
+	}
+	f.touch(stored)
+	f.policies[stored.Name] = stored
+	return f.operation("insert", stored.Name), nil
+}
+
+// Patch updates the policy attributes. Rules are ignored, and a stale fingerprint is rejected.
+func (f *FakeSecurityPolicyBackend) Patch(ctx context.Context, name string, policy *compute.SecurityPolicy) (*compute.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored, ok := f.policies[name]
+	if !ok {
+		return nil, policyNotFoundError(f.scope(), name)
+	}
+	if policy.Fingerprint != "" && policy.Fingerprint != stored.Fingerprint {
+		return nil, &googleapi.Error{Code: http.StatusPreconditionFailed, Message: "Supplied fingerprint does not match current metadata fingerprint."}
+	}
+	patched := patchSecurityPolicy(stored, policy)
+	f.policies[name] = patched
+	f.touch(patched)
+	return f.operation("patch", name), nil
+}
+
+// Delete removes the policy.
+func (f *FakeSecurityPolicyBackend) Delete(ctx context.Context, name string) (*compute.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.policies[name]; !ok {
+		return nil, policyNotFoundError(f.scope(), name)
+	}
+	delete(f.policies, name)
+	return f.operation("delete", name), nil
+}
+
+// AddRule adds the rule. The priority must not be used yet.
+func (f *FakeSecurityPolicyBackend) AddRule(ctx context.Context, name string, rule *compute.SecurityPolicyRule) (*compute.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored, ok := f.policies[name]
+	if !ok {
+		return nil, policyNotFoundError(f.scope(), name)
+	}
+	if ruleIndex(stored, rule.Priority) >= 0 {
+		return nil, invalidPriorityError(rule.Priority)
+	}
+	stored.Rules = append(stored.Rules, copySecurityPolicyRule(rule))
+	f.touch(stored)
+	return f.operation("addRule", name), nil
+}
+
+// PatchRule merges the rule into the rule at priority, as patchRule API does.
+// Nested objects are merged, and the fields in NullFields are cleared.
+func (f *FakeSecurityPolicyBackend) PatchRule(ctx context.Context, name string, priority int64, rule *compute.SecurityPolicyRule) (*compute.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored, ok := f.policies[name]
+	if !ok {
+		return nil, policyNotFoundError(f.scope(), name)
+	}
+	i := ruleIndex(stored, priority)
+	if i < 0 {
+		return nil, invalidPriorityError(priority)
+	}
+	patched := patchSecurityPolicyRule(stored.Rules[i], rule)
+	patched.Priority = priority
+	stored.Rules[i] = patched
+	f.touch(stored)
+	return f.operation("patchRule", name), nil
+}
+
+// RemoveRule removes the rule at priority. The default rule can not be removed.
+func (f *FakeSecurityPolicyBackend) RemoveRule(ctx context.Context, name string, priority int64) (*compute.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored, ok := f.policies[name]
+	if !ok {
+		return nil, policyNotFoundError(f.scope(), name)
+	}
+	i := ruleIndex(stored, priority)
+	if i < 0 || priority == 2147483647 {
+		return nil, invalidPriorityError(priority)
+	}
+	stored.Rules = append(stored.Rules[:i], stored.Rules[i+1:]...)
+	f.touch(stored)
+	return f.operation("removeRule", name), nil
+}
+
+// touch sorts rules by priority and renews the fingerprint.
+func (f *FakeSecurityPolicyBackend) touch(policy *compute.SecurityPolicy) {
+	sort.Slice(policy.Rules, func(i, j int) bool {
+		return policy.Rules[i].Priority < policy.Rules[j].Priority
+	})
+	f.sequence++
+	policy.Fingerprint = base64.StdEncoding.EncodeToString([]byte(strconv.FormatUint(f.sequence, 10)))
+}
+
+// operation records a finished operation.
+func (f *FakeSecurityPolicyBackend) operation(operationType string, name string) *compute.Operation {
+	f.sequence++
+	op := &compute.Operation{
+		Kind:          "compute#operation",
+		Name:          fmt.Sprintf("operation-%d", f.sequence),
+		OperationType: operationType,
+		Status:        "DONE",
+		Progress:      100,
+		TargetLink:    f.scope() + "/securityPolicies/" + name,
+		Error:         f.nextOperation,
+	}
+	f.nextOperation = nil
+	f.operations = append(f.operations, op)
+	return op
+}
+
+func ruleIndex(policy *compute.SecurityPolicy, priority int64) int {
+	for i, rule := range policy.Rules {
+		if rule.Priority == priority {
+			return i
+		}
+	}
+	return -1
+}
+
+func policyNotFoundError(scope, name string) error {
+	return &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("The resource '%s/securityPolicies/%s' was not found", scope, name)}
+}
+
+func invalidPriorityError(priority int64) error {
+	return &googleapi.Error{Code: http.StatusBadRequest, Message: fmt.Sprintf("Invalid value for field 'priority': '%d'.", priority)}
+}
+
+// patchSecurityPolicy returns stored with the fields present in patch, as Patch API does.
+// Fields in NullFields of patch are cleared. Rules and output only fields are kept.
+func patchSecurityPolicy(stored, patch *compute.SecurityPolicy) *compute.SecurityPolicy {
+	storedFields := map[string]interface{}{}
+	patchFields := map[string]interface{}{}
+	b, _ := json.Marshal(stored)
+	json.Unmarshal(b, &storedFields)
+	b, _ = json.Marshal(patch)
+	json.Unmarshal(b, &patchFields)
+	for key, value := range patchFields {
+		switch key {
+		case "id", "kind", "name", "selfLink", "fingerprint", "rules", "creationTimestamp":
+			continue
+		}
+		if value == nil {
+			delete(storedFields, key)
+			continue
+		}
+		storedFields[key] = value
+	}
+	out := &compute.SecurityPolicy{}
+	b, _ = json.Marshal(storedFields)
+	json.Unmarshal(b, out)
+	return out
+}
+
+// patchSecurityPolicyRule returns stored with the fields present in patch merged, as patchRule API does.
+func patchSecurityPolicyRule(stored, patch *compute.SecurityPolicyRule) *compute.SecurityPolicyRule {
+	storedFields := map[string]interface{}{}
+	patchFields := map[string]interface{}{}
+	b, _ := json.Marshal(stored)
+	json.Unmarshal(b, &storedFields)
+	b, _ = json.Marshal(patch)
+	json.Unmarshal(b, &patchFields)
+	mergeJSONObject(storedFields, patchFields)
+	out := &compute.SecurityPolicyRule{}
+	b, _ = json.Marshal(storedFields)
+	json.Unmarshal(b, out)
+	return out
+}
+
+// mergeJSONObject merges patch into stored as a JSON merge patch.
+// Objects are merged recursively, null removes the field, and other values replace it.
+func mergeJSONObject(stored, patch map[string]interface{}) {
+	for key, value := range patch {
+		object, isObject := value.(map[string]interface{})
+		switch {
+		case value == nil:
+			delete(stored, key)
+		case isObject:
+			storedObject, ok := stored[key].(map[string]interface{})
+			if !ok {
+				storedObject = map[string]interface{}{}
+			}
+			mergeJSONObject(storedObject, object)
+			stored[key] = storedObject
+		default:
+			stored[key] = value
+		}
+	}
+}
+
+// srcIpRanges returns the source IP ranges of the rule of the priority in policy.
+func srcIpRanges(policy *compute.SecurityPolicy, priority int64) []string {
+	if policy == nil {
+		return nil
+	}
+	for _, rule := range policy.Rules {
+		if rule.Priority == priority && rule.Match != nil && rule.Match.Config != nil {
+			return rule.Match.Config.SrcIpRanges
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// InsertErrorReason classifies Security Policy Insert API failures.
+type InsertErrorReason string
+
+const (
+	InsertInvalidArgument  InsertErrorReason = "InvalidArgument"
+	InsertAlreadyExists    InsertErrorReason = "AlreadyExists"
+	InsertPermissionDenied InsertErrorReason = "PermissionDenied"
+	InsertQuotaExceeded    InsertErrorReason = "QuotaExceeded"
+	InsertUnknown          InsertErrorReason = "Unknown"
+)
+
+// InsertError is returned when Security Policy Insert API failed.
+type InsertError struct {
+	Reason InsertErrorReason
+	Err    error
+}
+
+func (e *InsertError) Error() string {
+	return fmt.Sprintf("insert security policy failed (%s): %v", e.Reason, e.Err)
+}
+
+// Result returns how the reconciler should requeue after the failure.
+// Invalid arguments are not requeued, they need a change of the custom resource.
+func (e *InsertError) Result() ctrl.Result {
+	switch e.Reason {
+	case InsertInvalidArgument:
+		return ctrl.Result{}
+	case InsertAlreadyExists:
+		// created concurrently, so apply it on the next reconcile.
+		return ctrl.Result{Requeue: true}
+	case InsertPermissionDenied:
+		return ctrl.Result{RequeueAfter: 5 * time.Minute}
+	case InsertQuotaExceeded:
+		return ctrl.Result{RequeueAfter: 1 * time.Minute}
+	}
+	return ctrl.Result{RequeueAfter: 10 * time.Second}
+}
+
+// newInsertError classifies err returned by Insert API or its operation.
+func newInsertError(err error) *InsertError {
+	return &InsertError{Reason: insertErrorReason(err), Err: err}
+}
+
+func insertErrorReason(err error) InsertErrorReason {
+	switch e := err.(type) {
+	case *googleapi.Error:
+		for _, item := range e.Errors {
+			switch item.Reason {
+			case "quotaExceeded", "rateLimitExceeded", "userRateLimitExceeded":
+				return InsertQuotaExceeded
+			}
+		}
+		switch e.Code {
+		case http.StatusBadRequest:
+			return InsertInvalidArgument
+		case http.StatusConflict:
+			return InsertAlreadyExists
+		case http.StatusForbidden, http.StatusUnauthorized:
+			return InsertPermissionDenied
+		case http.StatusTooManyRequests:
+			return InsertQuotaExceeded
+		}
+	case *OperationError:
+		for _, item := range e.Errors {
+			switch {
+			case strings.Contains(item.Code, "QUOTA"):
+				return InsertQuotaExceeded
+			case strings.Contains(item.Code, "ALREADY_EXISTS"):
+				return InsertAlreadyExists
+			case strings.Contains(item.Code, "PERMISSION") || strings.Contains(item.Code, "FORBIDDEN"):
+				return InsertPermissionDenied
+			case strings.HasPrefix(item.Code, "INVALID"):
+				return InsertInvalidArgument
+			}
+		}
+	}
+	return InsertUnknown
+}
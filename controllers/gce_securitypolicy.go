@@ -18,67 +18,100 @@ package controllers
 import (
 	context "context"
 	"fmt"
-	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/googleapi"
 
 	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
 	compute "google.golang.org/api/compute/v1"
 )
 
+const (
+	defaultOperationPollInterval = 2 * time.Second
+	operationTimeout             = 5 * time.Minute
+)
+
 // SecurityPolicyAPI is Google Compute SecurityPolicy API structure.
 type SecurityPolicyAPI struct {
-	Log logr.Logger
+	Log     logr.Logger
+	Backend SecurityPolicyBackend
+	// PollInterval is the interval to poll running operations. Defaults to 2 seconds.
+	PollInterval time.Duration
+}
+
+// OperationError is returned when a Compute operation finished with errors.
+type OperationError struct {
+	Operation string
+	Errors    []*compute.OperationErrorErrors
+}
+
+func (e *OperationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = fmt.Sprintf("%s: %s", err.Code, err.Message)
+	}
+	return fmt.Sprintf("operation %s failed: %s", e.Operation, strings.Join(messages, ", "))
 }
 
 // Get returns search results by id
 func (api *SecurityPolicyAPI) Get(ctx context.Context, name string) (*compute.SecurityPolicy, error) {
-	service, credentials, err := newSecurityPoliciesService(ctx)
-	if err != nil {
-		return nil, err
-	}
-	policy, err := service.Get(credentials.ProjectID, name).Do()
+	policy, err := api.Backend.Get(ctx, name)
 	if err != nil {
-		if e, ok := err.(*googleapi.Error); ok {
-			if e.Code == 404 {
-				//already deleted.
-				return nil, nil
-			}
+		if isNotFound(err) {
+			//already deleted.
+			return nil, nil
 		}
 		return nil, err
 	}
 	return policy, nil
 }
 
-// Create calls Security Policy Insert API
-func (api *SecurityPolicyAPI) Create(ctx context.Context, spec *cloudarmorv1beta1.SecurityPolicyStatus) error {
+// Create calls Security Policy Insert API, and returns the operation name.
+// Failures of the insert are returned as *InsertError.
+func (api *SecurityPolicyAPI) Create(ctx context.Context, spec *cloudarmorv1beta1.SecurityPolicySpec) (string, error) {
 	log := api.Log.WithValues("gcp_securitypolicy", spec.Name)
 
-	service, credentials, err := newSecurityPoliciesService(ctx)
-	if err != nil {
-		return err
-	}
-
 	log.Info("Insert SecurityPolicy")
 	rb := customResourceToSecurityPolicy(spec)
-	req := service.Insert(credentials.ProjectID, rb).Context(ctx)
-	if _, err := req.Do(); err != nil {
-		return nil
+	op, err := api.Backend.Insert(ctx, rb)
+	if err != nil {
+		return "", newInsertError(err)
 	}
-	return nil
+	if err := api.waitOperation(ctx, op); err != nil {
+		if _, ok := err.(*OperationError); ok {
+			return op.Name, newInsertError(err)
+		}
+		return op.Name, err
+	}
+	return op.Name, nil
 }
 
-//
-func (api *SecurityPolicyAPI) Apply(ctx context.Context, spec *cloudarmorv1beta1.SecurityPolicyStatus, current *compute.SecurityPolicy) error {
-	log := api.Log.WithValues("gcp_securitypolicy", spec.Name)
+// SecurityPolicyChanges are the differences of the security policy in Cloud Armor from the spec.
+type SecurityPolicyChanges struct {
+	AddRules    []*compute.SecurityPolicyRule
+	PatchRules  []*compute.SecurityPolicyRule
+	RemoveRules []int64
+	// Policy is true when the attributes of the security policy itself differ.
+	Policy bool
+	// Differences are human readable differences, in the form of "field: current -> desired".
+	Differences []string
+}
+
+// Empty returns true if Cloud Armor has the security policy of the spec.
+func (c *SecurityPolicyChanges) Empty() bool {
+	return len(c.AddRules) == 0 && len(c.PatchRules) == 0 && len(c.RemoveRules) == 0 && !c.Policy
+}
 
+func (c *SecurityPolicyChanges) String() string {
+	return strings.Join(c.Differences, "; ")
+}
+
+// Diff returns the changes to apply the spec to current.
+func (api *SecurityPolicyAPI) Diff(spec *cloudarmorv1beta1.SecurityPolicySpec, current *compute.SecurityPolicy) *SecurityPolicyChanges {
 	update := customResourceToSecurityPolicy(spec)
-	service, credentials, err := newSecurityPoliciesService(ctx)
-	if err != nil {
-		return err
-	}
+	changes := &SecurityPolicyChanges{}
 
 	// generate priority map.
 	currentPriorityMap := make(map[int64]*compute.SecurityPolicyRule, len(current.Rules))
@@ -86,96 +119,151 @@ func (api *SecurityPolicyAPI) Apply(ctx context.Context, spec *cloudarmorv1beta1
 		currentPriorityMap[rule.Priority] = rule
 	}
 
-	updatePriorityMap := make(map[int64]*compute.SecurityPolicyRule, len(update.Rules))
-	for _, rule := range update.Rules {
-		updatePriorityMap[rule.Priority] = rule
-	}
-
 	//Rules check
-	for priority, updateRule := range updatePriorityMap {
-		if currentRule, ok := currentPriorityMap[priority]; ok {
-			if updateRule.Action != currentRule.Action || updateRule.Description != currentRule.Description || !reflect.DeepEqual(updateRule.Match.Config.SrcIpRanges, currentRule.Match.Config.SrcIpRanges) {
-				log.Info(fmt.Sprintf("Patch SecurityPolicy Rule [ priority=%d ]", updateRule.Priority))
-				req := service.PatchRule(credentials.ProjectID, update.Name, updateRule).Context(ctx).Priority(updateRule.Priority)
-				if _, err := req.Do(); err != nil {
-					return err
+	updatePriorityMap := make(map[int64]*compute.SecurityPolicyRule, len(update.Rules))
+	for _, updateRule := range update.Rules {
+		updatePriorityMap[updateRule.Priority] = updateRule
+		if currentRule, ok := currentPriorityMap[updateRule.Priority]; ok {
+			if diffs := diffSecurityPolicyRule(updateRule, currentRule); len(diffs) > 0 {
+				updateRule.NullFields = nullSecurityPolicyRuleFields(updateRule, currentRule)
+				if updateRule.Match != nil && currentRule.Match != nil {
+					updateRule.Match.NullFields = nullSecurityPolicyRuleMatcherFields(updateRule.Match, currentRule.Match)
+				}
+				changes.PatchRules = append(changes.PatchRules, updateRule)
+				for _, diff := range diffs {
+					changes.Differences = append(changes.Differences, fmt.Sprintf("rule %d %s", updateRule.Priority, diff))
 				}
 			}
 		} else {
-			log.Info(fmt.Sprintf("Add SecurityPolicy Rule [ priority=%d ]", updateRule.Priority))
-			req := service.AddRule(credentials.ProjectID, update.Name, updateRule).Context(ctx)
-			if _, err := req.Do(); err != nil {
-				return err
-			}
+			changes.AddRules = append(changes.AddRules, updateRule)
+			changes.Differences = append(changes.Differences, fmt.Sprintf("rule %d: missing", updateRule.Priority))
 		}
 	}
-	for priority, currentRule := range currentPriorityMap {
-		if _, ok := updatePriorityMap[priority]; !ok {
-			log.Info(fmt.Sprintf("Remove SecurityPolicy Rule [ priority=%d ]", currentRule.Priority))
-			req := service.RemoveRule(credentials.ProjectID, update.Name).Context(ctx).Priority(currentRule.Priority)
-			if _, err := req.Do(); err != nil {
-				return err
-			}
+	for _, currentRule := range current.Rules {
+		if _, ok := updatePriorityMap[currentRule.Priority]; !ok {
+			changes.RemoveRules = append(changes.RemoveRules, currentRule.Priority)
+			changes.Differences = append(changes.Differences, fmt.Sprintf("rule %d: not in spec", currentRule.Priority))
+		}
+	}
+
+	if diffs := diffSecurityPolicy(update, current); len(diffs) > 0 {
+		changes.Policy = true
+		changes.Differences = append(changes.Differences, diffs...)
+	}
+	return changes
+}
+
+// Apply calls Security Policy rule APIs and Patch API for the differences from current.
+// It returns the name of the last operation, or empty string if nothing changed.
+func (api *SecurityPolicyAPI) Apply(ctx context.Context, spec *cloudarmorv1beta1.SecurityPolicySpec, current *compute.SecurityPolicy) (string, error) {
+	log := api.Log.WithValues("gcp_securitypolicy", spec.Name)
+
+	var operation string
+	if policyType := string(securityPolicyType(spec)); current.Type != "" && current.Type != policyType {
+		return operation, fmt.Errorf("type of security policy %s can not be changed from %s to %s", spec.Name, current.Type, policyType)
+	}
+	changes := api.Diff(spec, current)
+	wait := func(op *compute.Operation, err error) error {
+		if err != nil {
+			return err
 		}
+		operation = op.Name
+		return api.waitOperation(ctx, op)
 	}
 
-	if update.Name != current.Name || update.Description != current.Description {
+	for _, rule := range changes.PatchRules {
+		log.Info(fmt.Sprintf("Patch SecurityPolicy Rule [ priority=%d ]", rule.Priority))
+		if err := wait(api.Backend.PatchRule(ctx, spec.Name, rule.Priority, rule)); err != nil {
+			return operation, err
+		}
+	}
+	for _, rule := range changes.AddRules {
+		log.Info(fmt.Sprintf("Add SecurityPolicy Rule [ priority=%d ]", rule.Priority))
+		if err := wait(api.Backend.AddRule(ctx, spec.Name, rule)); err != nil {
+			return operation, err
+		}
+	}
+	for _, priority := range changes.RemoveRules {
+		log.Info(fmt.Sprintf("Remove SecurityPolicy Rule [ priority=%d ]", priority))
+		if err := wait(api.Backend.RemoveRule(ctx, spec.Name, priority)); err != nil {
+			return operation, err
+		}
+	}
+
+	if changes.Policy {
 		log.Info("Patch SecurityPolicy")
-		update.Fingerprint = current.Fingerprint
+		update := customResourceToSecurityPolicy(spec)
+		// rule changes above renew the fingerprint.
+		latest, err := api.Backend.Get(ctx, update.Name)
+		if err != nil {
+			return operation, err
+		}
+		update.Fingerprint = latest.Fingerprint
 		update.Id = current.Id
 		update.Rules = nil
-		req := service.Patch(credentials.ProjectID, update.Name, update).Context(ctx)
-		if _, err := req.Do(); err != nil {
-			return err
+		if update.RecaptchaOptionsConfig == nil && current.RecaptchaOptionsConfig != nil {
+			update.NullFields = append(update.NullFields, "RecaptchaOptionsConfig")
+		}
+		if update.AdvancedOptionsConfig != nil && current.AdvancedOptionsConfig != nil {
+			update.AdvancedOptionsConfig.NullFields = nullAdvancedOptionsConfigFields(update.AdvancedOptionsConfig, current.AdvancedOptionsConfig)
+		}
+		if err := wait(api.Backend.Patch(ctx, update.Name, update)); err != nil {
+			return operation, err
 		}
 	}
-	return nil
+	return operation, nil
 }
 
 // Delete is delete security policy.
 func (api *SecurityPolicyAPI) Delete(ctx context.Context, name string) error {
-	service, credentials, err := newSecurityPoliciesService(ctx)
-	if err != nil {
-		return err
-	}
-
-	_, err = service.Delete(credentials.ProjectID, name).Do()
+	op, err := api.Backend.Delete(ctx, name)
 	if err != nil {
-		if e, ok := err.(*googleapi.Error); ok {
-			if e.Code == 404 {
-				//already deleted.
-				return nil
-			}
+		if isNotFound(err) {
+			//already deleted.
+			return nil
 		}
 		return err
 	}
-	return nil
+	return api.waitOperation(ctx, op)
 }
 
-// newSecurityPoliciesService returns SecurityPoliciesService and default credential.
-func newSecurityPoliciesService(ctx context.Context) (*compute.SecurityPoliciesService, *google.Credentials, error) {
-	c, err := google.DefaultClient(ctx, compute.CloudPlatformScope)
-	if err != nil {
-		return nil, nil, err
+// waitOperation polls the global operation until DONE, and returns OperationError if it failed.
+func (api *SecurityPolicyAPI) waitOperation(ctx context.Context, op *compute.Operation) error {
+	interval := api.PollInterval
+	if interval == 0 {
+		interval = defaultOperationPollInterval
 	}
-	computeService, err := compute.New(c)
-	if err != nil {
-		return nil, nil, err
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+
+	name := op.Name
+	for op.Status != "DONE" {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("operation %s did not finish: %v", name, ctx.Err())
+		case <-time.After(interval):
+		}
+		var err error
+		op, err = api.Backend.GetOperation(ctx, name)
+		if err != nil {
+			return err
+		}
 	}
-	credentials, err := google.FindDefaultCredentials(ctx, compute.ComputeScope)
-	if err != nil {
-		return nil, nil, err
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		return &OperationError{Operation: name, Errors: op.Error.Errors}
 	}
-
-	return computeService.SecurityPolicies, credentials, nil
+	return nil
 }
 
 // customResourceToSecurityPolicyRule convert cloudarmorv1beta1.SecurityPolicyRule to compute.SecurityPolicyRule
 func customResourceToSecurityPolicyRule(rule *cloudarmorv1beta1.SecurityPolicyRule) *compute.SecurityPolicyRule {
-	return &compute.SecurityPolicyRule{
+	result := &compute.SecurityPolicyRule{
 		Action:      rule.Action,
 		Description: rule.Description,
 		Priority:    rule.Priority,
+		Preview:     rule.Preview,
+		// patchRule has to send false to enforce the rule in preview.
+		ForceSendFields: []string{"Preview"},
 		Match: &compute.SecurityPolicyRuleMatcher{
 			VersionedExpr: "SRC_IPS_V1",
 			Config: &compute.SecurityPolicyRuleMatcherConfig{
@@ -183,34 +271,275 @@ func customResourceToSecurityPolicyRule(rule *cloudarmorv1beta1.SecurityPolicyRu
 			},
 		},
 	}
+	if rule.Expression != "" {
+		result.Match = &compute.SecurityPolicyRuleMatcher{
+			Expr: &compute.Expr{
+				Expression: rule.Expression,
+			},
+		}
+	}
+	if rule.PreconfiguredWaf != nil {
+		result.Match = &compute.SecurityPolicyRuleMatcher{
+			Expr: &compute.Expr{
+				Expression: preconfiguredWafExpression(rule.PreconfiguredWaf),
+			},
+		}
+		result.PreconfiguredWafConfig = preconfiguredWafConfig(rule.PreconfiguredWaf)
+	}
+	if rule.RateLimitOptions != nil {
+		result.RateLimitOptions = customResourceToRateLimitOptions(rule.RateLimitOptions)
+	}
+	if rule.RedirectOptions != nil {
+		result.RedirectOptions = &compute.SecurityPolicyRuleRedirectOptions{
+			Type:   rule.RedirectOptions.Type,
+			Target: rule.RedirectOptions.Target,
+		}
+	}
+	if len(rule.RequestHeadersToAdd) > 0 {
+		result.HeaderAction = &compute.SecurityPolicyRuleHttpHeaderAction{}
+		for _, header := range rule.RequestHeadersToAdd {
+			result.HeaderAction.RequestHeadersToAdds = append(result.HeaderAction.RequestHeadersToAdds, &compute.SecurityPolicyRuleHttpHeaderActionHttpHeaderOption{
+				HeaderName:  header.Name,
+				HeaderValue: header.Value,
+			})
+		}
+	}
+	return result
 }
 
-// defaultSecurityPolicyRule generates default security policy rule.
-func defaultSecurityPolicyRule(spec *cloudarmorv1beta1.SecurityPolicyStatus) *compute.SecurityPolicyRule {
-	return &compute.SecurityPolicyRule{
-		Action:      spec.DefaultAction,
-		Description: "This is default action",
-		Priority:    2147483647,
-		Match: &compute.SecurityPolicyRuleMatcher{
-			VersionedExpr: "SRC_IPS_V1",
-			Config: &compute.SecurityPolicyRuleMatcherConfig{
-				SrcIpRanges: []string{"*"},
-			},
+// customResourceToRateLimitOptions converts rateLimitOptions with the defaults of Cloud Armor.
+func customResourceToRateLimitOptions(options *cloudarmorv1beta1.RateLimitOptions) *compute.SecurityPolicyRuleRateLimitOptions {
+	result := &compute.SecurityPolicyRuleRateLimitOptions{
+		RateLimitThreshold: &compute.SecurityPolicyRuleRateLimitOptionsThreshold{
+			Count:       options.RateLimitThreshold.Count,
+			IntervalSec: options.RateLimitThreshold.IntervalSec,
 		},
+		ConformAction:    options.ConformAction,
+		ExceedAction:     options.ExceedAction,
+		BanDurationSec:   options.BanDurationSec,
+		EnforceOnKey:     options.EnforceOnKey,
+		EnforceOnKeyName: options.EnforceOnKeyName,
+	}
+	if result.ConformAction == "" {
+		result.ConformAction = "allow"
+	}
+	if result.EnforceOnKey == "" {
+		result.EnforceOnKey = "ALL"
+	}
+	if options.BanThreshold != nil {
+		result.BanThreshold = &compute.SecurityPolicyRuleRateLimitOptionsThreshold{
+			Count:       options.BanThreshold.Count,
+			IntervalSec: options.BanThreshold.IntervalSec,
+		}
+	}
+	return result
+}
+
+// preconfiguredWafExpression generates the evaluatePreconfiguredWaf expression of the rule set,
+// such as evaluatePreconfiguredWaf('sqli-v33-stable', {'sensitivity': 1, 'opt_out_rule_ids': ['owasp-crs-v030301-id942350-sqli']}).
+func preconfiguredWafExpression(waf *cloudarmorv1beta1.PreconfiguredWaf) string {
+	options := []string{}
+	if waf.Sensitivity != nil {
+		options = append(options, fmt.Sprintf("'sensitivity': %d", *waf.Sensitivity))
 	}
+	if len(waf.OptInRuleIDs) > 0 {
+		options = append(options, fmt.Sprintf("'opt_in_rule_ids': [%s]", quoteRuleIDs(waf.OptInRuleIDs)))
+	}
+	if len(waf.OptOutRuleIDs) > 0 {
+		options = append(options, fmt.Sprintf("'opt_out_rule_ids': [%s]", quoteRuleIDs(waf.OptOutRuleIDs)))
+	}
+	if len(options) == 0 {
+		return fmt.Sprintf("evaluatePreconfiguredWaf('%s')", waf.RuleSet)
+	}
+	return fmt.Sprintf("evaluatePreconfiguredWaf('%s', {%s})", waf.RuleSet, strings.Join(options, ", "))
+}
+
+func quoteRuleIDs(ids []string) string {
+	quoted := make([]string, len(ids))
+	for i, id := range ids {
+		quoted[i] = "'" + id + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// preconfiguredWafConfig converts the exclusions of the rule set, or returns nil if there is none.
+func preconfiguredWafConfig(waf *cloudarmorv1beta1.PreconfiguredWaf) *compute.SecurityPolicyRulePreconfiguredWafConfig {
+	if len(waf.Exclusions) == 0 {
+		return nil
+	}
+	config := &compute.SecurityPolicyRulePreconfiguredWafConfig{}
+	for _, exclusion := range waf.Exclusions {
+		config.Exclusions = append(config.Exclusions, &compute.SecurityPolicyRulePreconfiguredWafConfigExclusion{
+			TargetRuleSet:               waf.RuleSet,
+			TargetRuleIds:               exclusion.TargetRuleIDs,
+			RequestHeadersToExclude:     preconfiguredWafExclusionFields(exclusion.RequestHeaders),
+			RequestCookiesToExclude:     preconfiguredWafExclusionFields(exclusion.RequestCookies),
+			RequestQueryParamsToExclude: preconfiguredWafExclusionFields(exclusion.RequestQueryParams),
+			RequestUrisToExclude:        preconfiguredWafExclusionFields(exclusion.RequestUris),
+		})
+	}
+	return config
+}
+
+func preconfiguredWafExclusionFields(fields []cloudarmorv1beta1.PreconfiguredWafExclusionField) []*compute.SecurityPolicyRulePreconfiguredWafConfigExclusionFieldParams {
+	if len(fields) == 0 {
+		return nil
+	}
+	result := make([]*compute.SecurityPolicyRulePreconfiguredWafConfigExclusionFieldParams, len(fields))
+	for i, field := range fields {
+		result[i] = &compute.SecurityPolicyRulePreconfiguredWafConfigExclusionFieldParams{
+			Op:  field.Operator,
+			Val: field.Value,
+		}
+	}
+	return result
+}
+
+// defaultSecurityPolicyRule generates default security policy rule from defaultRule or defaultAction.
+func defaultSecurityPolicyRule(spec *cloudarmorv1beta1.SecurityPolicySpec) *compute.SecurityPolicyRule {
+	rule := spec.SecurityPolicyDefaultRule()
+	return customResourceToSecurityPolicyRule(&rule)
 }
 
-// customResourceToSecurityPolicy convert cloudarmorv1beta1.SecurityPolicyStatus to compute.SecurityPolicy.
-func customResourceToSecurityPolicy(spec *cloudarmorv1beta1.SecurityPolicyStatus) *compute.SecurityPolicy {
+// customResourceToSecurityPolicy convert cloudarmorv1beta1.SecurityPolicySpec to compute.SecurityPolicy.
+func customResourceToSecurityPolicy(spec *cloudarmorv1beta1.SecurityPolicySpec) *compute.SecurityPolicy {
 	rules := make([]*compute.SecurityPolicyRule, len(spec.Rules))
 	for i, _ := range rules {
 		rules[i] = customResourceToSecurityPolicyRule(&spec.Rules[i])
+		if spec.PreviewRules {
+			rules[i].Preview = true
+		}
 	}
 	rules = append(rules, defaultSecurityPolicyRule(spec))
 	rb := &compute.SecurityPolicy{
 		Name:        spec.Name,
 		Description: spec.Description,
+		Type:        string(securityPolicyType(spec)),
 		Rules:       rules,
 	}
+	switch securityPolicyType(spec) {
+	case cloudarmorv1beta1.SecurityPolicyTypeCloudArmorNetwork:
+		for _, rule := range rb.Rules {
+			toNetworkRule(rule)
+		}
+	case cloudarmorv1beta1.SecurityPolicyTypeCloudArmor:
+		if spec.RecaptchaOptionsConfig != nil {
+			rb.RecaptchaOptionsConfig = &compute.SecurityPolicyRecaptchaOptionsConfig{
+				RedirectSiteKey: spec.RecaptchaOptionsConfig.RedirectSiteKey,
+			}
+		}
+		rb.AdaptiveProtectionConfig = customResourceToAdaptiveProtectionConfig(spec.AdaptiveProtection)
+		rb.AdvancedOptionsConfig = customResourceToAdvancedOptionsConfig(spec.AdvancedOptionsConfig)
+	}
 	return rb
 }
+
+// securityPolicyType returns the type of the spec, defaulting to CLOUD_ARMOR.
+func securityPolicyType(spec *cloudarmorv1beta1.SecurityPolicySpec) cloudarmorv1beta1.SecurityPolicyType {
+	if spec.Type == "" {
+		return cloudarmorv1beta1.SecurityPolicyTypeCloudArmor
+	}
+	return spec.Type
+}
+
+// toNetworkRule moves the addresses of rule to networkMatch, as the rules of CLOUD_ARMOR_NETWORK match packets.
+// Packets have no HTTP status, so deny actions are converted to deny.
+func toNetworkRule(rule *compute.SecurityPolicyRule) {
+	if rule.Match != nil && rule.Match.Config != nil {
+		rule.NetworkMatch = &compute.SecurityPolicyRuleNetworkMatcher{
+			SrcIpRanges: rule.Match.Config.SrcIpRanges,
+		}
+	}
+	rule.Match = nil
+	if strings.HasPrefix(rule.Action, "deny") {
+		rule.Action = "deny"
+	}
+}
+
+// customResourceToAdvancedOptionsConfig converts advancedOptionsConfig with the defaults of Cloud Armor.
+// Unset advancedOptionsConfig is converted to the defaults, so that Patch API restores them.
+func customResourceToAdvancedOptionsConfig(options *cloudarmorv1beta1.AdvancedOptionsConfig) *compute.SecurityPolicyAdvancedOptionsConfig {
+	config := &compute.SecurityPolicyAdvancedOptionsConfig{
+		JsonParsing: "DISABLED",
+		LogLevel:    "NORMAL",
+	}
+	if options == nil {
+		return config
+	}
+	if options.JsonParsing != "" {
+		config.JsonParsing = options.JsonParsing
+	}
+	if options.LogLevel != "" {
+		config.LogLevel = options.LogLevel
+	}
+	if options.JsonCustomConfig != nil {
+		config.JsonCustomConfig = &compute.SecurityPolicyAdvancedOptionsConfigJsonCustomConfig{
+			ContentTypes: options.JsonCustomConfig.ContentTypes,
+		}
+	}
+	config.UserIpRequestHeaders = options.UserIpRequestHeaders
+	return config
+}
+
+// customResourceToAdaptiveProtectionConfig converts adaptiveProtection with the defaults of Cloud Armor.
+// Unset adaptiveProtection is converted to the disabled config, so that Patch API disables it.
+func customResourceToAdaptiveProtectionConfig(adaptiveProtection *cloudarmorv1beta1.AdaptiveProtection) *compute.SecurityPolicyAdaptiveProtectionConfig {
+	config := &compute.SecurityPolicyAdaptiveProtectionConfigLayer7DdosDefenseConfig{
+		ForceSendFields: []string{"Enable"},
+	}
+	if adaptiveProtection != nil {
+		spec := adaptiveProtection.Layer7DdosDefenseConfig
+		config.Enable = spec.Enable
+		config.RuleVisibility = spec.RuleVisibility
+		for _, threshold := range spec.ThresholdConfigs {
+			config.ThresholdConfigs = append(config.ThresholdConfigs, &compute.SecurityPolicyAdaptiveProtectionConfigLayer7DdosDefenseConfigThresholdConfig{
+				Name:                                threshold.Name,
+				AutoDeployLoadThreshold:             parseThreshold(threshold.AutoDeployLoadThreshold),
+				AutoDeployConfidenceThreshold:       parseThreshold(threshold.AutoDeployConfidenceThreshold),
+				AutoDeployImpactedBaselineThreshold: parseThreshold(threshold.AutoDeployImpactedBaselineThreshold),
+				AutoDeployExpirationSec:             threshold.AutoDeployExpirationSec,
+			})
+		}
+	}
+	if config.Enable && config.RuleVisibility == "" {
+		config.RuleVisibility = "STANDARD"
+	}
+	return &compute.SecurityPolicyAdaptiveProtectionConfig{Layer7DdosDefenseConfig: config}
+}
+
+// parseThreshold parses the decimal threshold the CRD validated. Empty is left to the default of Cloud Armor.
+func parseThreshold(threshold string) float64 {
+	value, _ := strconv.ParseFloat(threshold, 64)
+	return value
+}
+
+// securityPolicyToStatus sets the state read back from Cloud Armor to status.
+func securityPolicyToStatus(policy *compute.SecurityPolicy, status *cloudarmorv1beta1.SecurityPolicyStatus) {
+	status.ID = strconv.FormatUint(policy.Id, 10)
+	status.Name = policy.Name
+	status.Type = policy.Type
+	status.Region = ""
+	if policy.Region != "" {
+		status.Region = policy.Region[strings.LastIndex(policy.Region, "/")+1:]
+	}
+	status.SelfLink = policy.SelfLink
+	status.Fingerprint = policy.Fingerprint
+	status.Rules = make([]cloudarmorv1beta1.SecurityPolicyRuleStatus, len(policy.Rules))
+	for i, rule := range policy.Rules {
+		status.Rules[i] = cloudarmorv1beta1.SecurityPolicyRuleStatus{
+			Action:      rule.Action,
+			Description: rule.Description,
+			Priority:    rule.Priority,
+			Preview:     rule.Preview,
+		}
+		if rule.Match != nil && rule.Match.Config != nil {
+			status.Rules[i].SrcIpRanges = rule.Match.Config.SrcIpRanges
+		}
+		if rule.NetworkMatch != nil {
+			status.Rules[i].SrcIpRanges = rule.NetworkMatch.SrcIpRanges
+		}
+		if rule.Match != nil && rule.Match.Expr != nil {
+			status.Rules[i].Expression = rule.Match.Expr.Expression
+		}
+	}
+}
@@ -0,0 +1,264 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// diffSecurityPolicyRule compares every field of the rules after normalizing them,
+// and returns the differences in the form of "field: current -> desired".
+// It returns nil if the rules are equivalent.
+func diffSecurityPolicyRule(desired, current *compute.SecurityPolicyRule) []string {
+	return diffJSONValues("", jsonValue(normalizeSecurityPolicyRule(current)), jsonValue(normalizeSecurityPolicyRule(desired)))
+}
+
+// diffSecurityPolicy compares the attributes of the security policy the operator manages,
+// and returns the differences in the form of "field: current -> desired". Rules are compared by diffSecurityPolicyRule.
+func diffSecurityPolicy(desired, current *compute.SecurityPolicy) []string {
+	return diffJSONValues("", jsonValue(managedSecurityPolicy(current)), jsonValue(managedSecurityPolicy(desired)))
+}
+
+// managedSecurityPolicy returns the attributes of policy the operator manages.
+// Other attributes are left to Cloud Armor and other tools.
+func managedSecurityPolicy(policy *compute.SecurityPolicy) *compute.SecurityPolicy {
+	managed := copySecurityPolicy(&compute.SecurityPolicy{
+		Description:              policy.Description,
+		RecaptchaOptionsConfig:   policy.RecaptchaOptionsConfig,
+		AdaptiveProtectionConfig: policy.AdaptiveProtectionConfig,
+		AdvancedOptionsConfig:    policy.AdvancedOptionsConfig,
+	})
+	// disabled Adaptive Protection is the same as unset.
+	if config := managed.AdaptiveProtectionConfig; config != nil {
+		defense := config.Layer7DdosDefenseConfig
+		switch {
+		case defense == nil || (!defense.Enable && len(defense.ThresholdConfigs) == 0):
+			managed.AdaptiveProtectionConfig = nil
+		case defense.RuleVisibility == "":
+			defense.RuleVisibility = "STANDARD"
+		}
+	}
+	// advanced options with the defaults are the same as unset.
+	if config := managed.AdvancedOptionsConfig; config != nil {
+		if config.JsonParsing == "" {
+			config.JsonParsing = "DISABLED"
+		}
+		if config.LogLevel == "" {
+			config.LogLevel = "NORMAL"
+		}
+		if config.JsonCustomConfig != nil && len(config.JsonCustomConfig.ContentTypes) == 0 {
+			config.JsonCustomConfig = nil
+		}
+		if config.JsonParsing == "DISABLED" && config.LogLevel == "NORMAL" && config.JsonCustomConfig == nil && len(config.UserIpRequestHeaders) == 0 {
+			managed.AdvancedOptionsConfig = nil
+		}
+	}
+	return managed
+}
+
+// normalizeSecurityPolicyRule returns a copy of rule in the canonical form.
+// Output only fields are cleared, defaults of Cloud Armor are filled, and address ranges and headers are sorted.
+func normalizeSecurityPolicyRule(rule *compute.SecurityPolicyRule) *compute.SecurityPolicyRule {
+	normalized := copySecurityPolicyRule(rule)
+	normalized.Kind = ""
+	if match := normalized.Match; match != nil {
+		if match.Config != nil {
+			match.Config.SrcIpRanges = canonicalIPRanges(match.Config.SrcIpRanges)
+		}
+		if match.Expr != nil {
+			match.Expr.Expression = strings.TrimSpace(match.Expr.Expression)
+		}
+	}
+	if match := normalized.NetworkMatch; match != nil {
+		match.SrcIpRanges = canonicalIPRanges(match.SrcIpRanges)
+		match.DestIpRanges = canonicalIPRanges(match.DestIpRanges)
+	}
+	if options := normalized.RateLimitOptions; options != nil {
+		if options.ConformAction == "" {
+			options.ConformAction = "allow"
+		}
+		if options.EnforceOnKey == "" {
+			options.EnforceOnKey = "ALL"
+		}
+	}
+	if action := normalized.HeaderAction; action != nil {
+		sort.SliceStable(action.RequestHeadersToAdds, func(i, j int) bool {
+			return action.RequestHeadersToAdds[i].HeaderName < action.RequestHeadersToAdds[j].HeaderName
+		})
+	}
+	return normalized
+}
+
+// nullSecurityPolicyRuleFields returns the optional fields which current has and desired has not,
+// so that patchRule clears them.
+func nullSecurityPolicyRuleFields(desired, current *compute.SecurityPolicyRule) []string {
+	var fields []string
+	if desired.HeaderAction == nil && current.HeaderAction != nil {
+		fields = append(fields, "HeaderAction")
+	}
+	if desired.PreconfiguredWafConfig == nil && current.PreconfiguredWafConfig != nil {
+		fields = append(fields, "PreconfiguredWafConfig")
+	}
+	if desired.RateLimitOptions == nil && current.RateLimitOptions != nil {
+		fields = append(fields, "RateLimitOptions")
+	}
+	if desired.RedirectOptions == nil && current.RedirectOptions != nil {
+		fields = append(fields, "RedirectOptions")
+	}
+	return fields
+}
+
+// nullSecurityPolicyRuleMatcherFields returns the matcher fields which current has and desired has not,
+// so that patchRule clears the matcher a rule switches from. Otherwise the rule keeps both of the matchers.
+func nullSecurityPolicyRuleMatcherFields(desired, current *compute.SecurityPolicyRuleMatcher) []string {
+	var fields []string
+	if desired.Config == nil && current.Config != nil {
+		fields = append(fields, "Config")
+	}
+	if desired.Expr == nil && current.Expr != nil {
+		fields = append(fields, "Expr")
+	}
+	if desired.VersionedExpr == "" && current.VersionedExpr != "" {
+		fields = append(fields, "VersionedExpr")
+	}
+	return fields
+}
+
+// nullAdvancedOptionsConfigFields returns the optional fields of the advanced options which current has and desired has not,
+// so that Patch API clears them.
+func nullAdvancedOptionsConfigFields(desired, current *compute.SecurityPolicyAdvancedOptionsConfig) []string {
+	var fields []string
+	if desired.JsonCustomConfig == nil && current.JsonCustomConfig != nil {
+		fields = append(fields, "JsonCustomConfig")
+	}
+	if len(desired.UserIpRequestHeaders) == 0 && len(current.UserIpRequestHeaders) > 0 {
+		fields = append(fields, "UserIpRequestHeaders")
+	}
+	return fields
+}
+
+// canonicalIPRanges converts addresses to CIDRs in the canonical form, and sorts them without duplicates.
+// Values which are not addresses, such as "*", are kept as they are.
+func canonicalIPRanges(ranges []string) []string {
+	if len(ranges) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(ranges))
+	result := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		r = canonicalIPRange(r)
+		if seen[r] {
+			continue
+		}
+		seen[r] = true
+		result = append(result, r)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func canonicalIPRange(r string) string {
+	r = strings.TrimSpace(r)
+	if _, ipNet, err := net.ParseCIDR(r); err == nil {
+		return ipNet.String()
+	}
+	if ip := net.ParseIP(r); ip != nil {
+		if ip.To4() != nil {
+			return ip.String() + "/32"
+		}
+		return ip.String() + "/128"
+	}
+	return r
+}
+
+// jsonValue converts v to the generic form of its JSON representation.
+func jsonValue(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	var value interface{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		return string(b)
+	}
+	return value
+}
+
+// diffJSONValues walks the objects of current and desired, and returns the differences of the leaves.
+func diffJSONValues(path string, current, desired interface{}) []string {
+	currentObject, currentIsObject := current.(map[string]interface{})
+	desiredObject, desiredIsObject := desired.(map[string]interface{})
+	if currentIsObject && desiredIsObject {
+		keys := make([]string, 0, len(currentObject)+len(desiredObject))
+		for key := range currentObject {
+			keys = append(keys, key)
+		}
+		for key := range desiredObject {
+			if _, ok := currentObject[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		var diffs []string
+		for _, key := range keys {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			diffs = append(diffs, diffJSONValues(childPath, currentObject[key], desiredObject[key])...)
+		}
+		return diffs
+	}
+	if reflect.DeepEqual(current, desired) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: %s -> %s", path, formatJSONValue(current), formatJSONValue(desired))}
+}
+
+func formatJSONValue(v interface{}) string {
+	if v == nil {
+		return "<unset>"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// copySecurityPolicy returns deep copy of compute.SecurityPolicy.
+func copySecurityPolicy(policy *compute.SecurityPolicy) *compute.SecurityPolicy {
+	out := &compute.SecurityPolicy{}
+	b, _ := json.Marshal(policy)
+	json.Unmarshal(b, out)
+	return out
+}
+
+// copySecurityPolicyRule returns deep copy of compute.SecurityPolicyRule.
+func copySecurityPolicyRule(rule *compute.SecurityPolicyRule) *compute.SecurityPolicyRule {
+	out := &compute.SecurityPolicyRule{}
+	b, _ := json.Marshal(rule)
+	json.Unmarshal(b, out)
+	return out
+}
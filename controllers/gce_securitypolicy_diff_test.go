@@ -0,0 +1,98 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	compute "google.golang.org/api/compute/v1"
+)
+
+var _ = Describe("diffSecurityPolicyRule", func() {
+	var desired *compute.SecurityPolicyRule
+
+	BeforeEach(func() {
+		desired = &compute.SecurityPolicyRule{
+			Action:   "allow",
+			Priority: 100,
+			Match: &compute.SecurityPolicyRuleMatcher{
+				VersionedExpr: "SRC_IPS_V1",
+				Config: &compute.SecurityPolicyRuleMatcherConfig{
+					SrcIpRanges: []string{"192.168.1.0/24", "10.0.0.1"},
+				},
+			},
+		}
+	})
+
+	It("should ignore the order and the form of addresses", func() {
+		current := copySecurityPolicyRule(desired)
+		current.Kind = "compute#securityPolicyRule"
+		current.Match.Config.SrcIpRanges = []string{"10.0.0.1/32", "192.168.1.0/24", "192.168.1.0/24"}
+		Expect(diffSecurityPolicyRule(desired, current)).To(BeEmpty())
+	})
+
+	It("should detect fields other than action, description and addresses", func() {
+		current := copySecurityPolicyRule(desired)
+		current.Preview = true
+		current.Match = &compute.SecurityPolicyRuleMatcher{
+			Expr: &compute.Expr{Expression: "origin.region_code == 'JP'"},
+		}
+		current.RateLimitOptions = &compute.SecurityPolicyRuleRateLimitOptions{ConformAction: "allow"}
+		Expect(diffSecurityPolicyRule(desired, current)).To(Equal([]string{
+			`match.config: <unset> -> {"srcIpRanges":["10.0.0.1/32","192.168.1.0/24"]}`,
+			`match.expr: {"expression":"origin.region_code == 'JP'"} -> <unset>`,
+			`match.versionedExpr: <unset> -> "SRC_IPS_V1"`,
+			`preview: true -> <unset>`,
+			`rateLimitOptions: {"conformAction":"allow","enforceOnKey":"ALL"} -> <unset>`,
+		}))
+	})
+})
+
+var _ = Describe("diffSecurityPolicyRule of rate limited rules", func() {
+	It("should fill the defaults of Cloud Armor and detect changes of the thresholds", func() {
+		desired := customResourceToSecurityPolicyRule(&cloudarmorv1beta1.SecurityPolicyRule{
+			Action:      "rate_based_ban",
+			Priority:    200,
+			SrcIpRanges: []string{"*"},
+			RateLimitOptions: &cloudarmorv1beta1.RateLimitOptions{
+				RateLimitThreshold: cloudarmorv1beta1.RateLimitThreshold{Count: 100, IntervalSec: 60},
+				ExceedAction:       "deny(429)",
+				BanDurationSec:     600,
+				BanThreshold:       &cloudarmorv1beta1.RateLimitThreshold{Count: 1000, IntervalSec: 600},
+			},
+		})
+		Expect(desired.RateLimitOptions.ConformAction).To(Equal("allow"))
+		Expect(desired.RateLimitOptions.EnforceOnKey).To(Equal("ALL"))
+
+		current := copySecurityPolicyRule(desired)
+		current.RateLimitOptions.EnforceOnKey = ""
+		Expect(diffSecurityPolicyRule(desired, current)).To(BeEmpty())
+
+		current.RateLimitOptions.BanThreshold.Count = 500
+		Expect(diffSecurityPolicyRule(desired, current)).To(Equal([]string{
+			"rateLimitOptions.banThreshold.count: 500 -> 1000",
+		}))
+	})
+})
+
+var _ = Describe("canonicalIPRanges", func() {
+	It("should canonicalize addresses and keep other values", func() {
+		Expect(canonicalIPRanges([]string{"192.168.1.10/24", "2001:DB8::1", "*", "10.0.0.1"})).To(Equal(
+			[]string{"*", "10.0.0.1/32", "192.168.1.0/24", "2001:db8::1/128"}))
+	})
+})
@@ -0,0 +1,678 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	"github.com/h-r-k-matsumoto/security-policy-operator/internal/computetest"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("SecurityPolicyAPI", func() {
+	var (
+		ctx     context.Context
+		backend *FakeSecurityPolicyBackend
+		api     *SecurityPolicyAPI
+		spec    *cloudarmorv1beta1.SecurityPolicySpec
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		backend = NewFakeSecurityPolicyBackend()
+		api = &SecurityPolicyAPI{Log: logf.Log, Backend: backend}
+		spec = &cloudarmorv1beta1.SecurityPolicySpec{
+			Name:          "policy",
+			Description:   "description",
+			DefaultAction: "deny(403)",
+			Rules: []cloudarmorv1beta1.SecurityPolicyRule{
+				{Action: "allow", Description: "rule 1", Priority: 100, SrcIpRanges: []string{"192.168.0.0/24"}},
+				{Action: "allow", Description: "rule 2", Priority: 101, SrcIpRanges: []string{"192.168.1.0/24"}},
+			},
+		}
+	})
+
+	Context("Get", func() {
+		It("should return nil for a missing policy", func() {
+			policy, err := api.Get(ctx, "missing")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy).To(BeNil())
+		})
+	})
+
+	Context("Create", func() {
+		It("should insert rules and the default rule", func() {
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+
+			policy, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Fingerprint).NotTo(BeEmpty())
+			Expect(priorities(policy)).To(Equal([]int64{100, 101, 2147483647}))
+			Expect(policy.Rules[2].Action).To(Equal("deny(403)"))
+		})
+
+		It("should return InsertError when the policy already exists", func() {
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = api.Create(ctx, spec)
+			Expect(err).To(BeAssignableToTypeOf(&InsertError{}))
+			Expect(err.(*InsertError).Reason).To(Equal(InsertAlreadyExists))
+		})
+
+		It("should return InsertError for invalid rules", func() {
+			spec.Rules[1].Priority = spec.Rules[0].Priority
+
+			_, err := api.Create(ctx, spec)
+			Expect(err).To(BeAssignableToTypeOf(&InsertError{}))
+			Expect(err.(*InsertError).Reason).To(Equal(InsertInvalidArgument))
+			Expect(err.(*InsertError).Result().Requeue).To(BeFalse())
+		})
+
+		It("should insert a network policy in the region with network matches", func() {
+			spec.Type = cloudarmorv1beta1.SecurityPolicyTypeCloudArmorNetwork
+			spec.Region = "asia-northeast1"
+			api.Backend = backend.InRegion(spec.Region)
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+
+			global, err := (&SecurityPolicyAPI{Log: logf.Log, Backend: backend}).Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(global).To(BeNil())
+			policy, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Type).To(Equal("CLOUD_ARMOR_NETWORK"))
+			Expect(policy.Region).To(HaveSuffix("/regions/asia-northeast1"))
+			Expect(policy.AdaptiveProtectionConfig).To(BeNil())
+			Expect(policy.Rules[0].Match).To(BeNil())
+			Expect(policy.Rules[0].NetworkMatch.SrcIpRanges).To(Equal([]string{"192.168.0.0/24"}))
+			Expect(policy.Rules[2].Action).To(Equal("deny"))
+			Expect(api.Diff(spec, policy).Empty()).To(BeTrue())
+
+			status := &cloudarmorv1beta1.SecurityPolicyStatus{}
+			securityPolicyToStatus(policy, status)
+			Expect(status.Region).To(Equal("asia-northeast1"))
+			Expect(status.Rules[0].SrcIpRanges).To(Equal([]string{"192.168.0.0/24"}))
+		})
+
+		It("should classify quota and permission errors", func() {
+			quota := &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}}
+			Expect(newInsertError(quota).Reason).To(Equal(InsertQuotaExceeded))
+			Expect(newInsertError(&googleapi.Error{Code: 403}).Reason).To(Equal(InsertPermissionDenied))
+		})
+	})
+
+	Context("Apply", func() {
+		It("should add, patch and remove rules", func() {
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+
+			spec.Description = "updated"
+			spec.Rules = []cloudarmorv1beta1.SecurityPolicyRule{
+				{Action: "deny(403)", Description: "rule 1", Priority: 100, SrcIpRanges: []string{"192.168.0.0/24"}},
+				{Action: "allow", Description: "rule 3", Priority: 102, SrcIpRanges: []string{"192.168.2.0/24"}},
+			}
+			operation, err := api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(operation).NotTo(BeEmpty())
+
+			policy, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Description).To(Equal("updated"))
+			Expect(priorities(policy)).To(Equal([]int64{100, 102, 2147483647}))
+			Expect(policy.Rules[0].Action).To(Equal("deny(403)"))
+		})
+
+		It("should switch a rule between addresses and an expression", func() {
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+
+			spec.Rules[0].SrcIpRanges = nil
+			spec.Rules[0].Expression = "origin.region_code == 'RU'"
+			changes := api.Diff(spec, current)
+			Expect(changes.PatchRules).To(HaveLen(1))
+			Expect(changes.PatchRules[0].Match.NullFields).To(Equal([]string{"Config", "VersionedExpr"}))
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+
+			policy, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Rules[0].Match.Config).To(BeNil())
+			Expect(policy.Rules[0].Match.VersionedExpr).To(BeEmpty())
+			Expect(policy.Rules[0].Match.Expr.Expression).To(Equal("origin.region_code == 'RU'"))
+			Expect(api.Diff(spec, policy).Empty()).To(BeTrue())
+
+			spec.Rules[0].SrcIpRanges = []string{"192.168.0.0/24"}
+			spec.Rules[0].Expression = ""
+			changes = api.Diff(spec, policy)
+			Expect(changes.PatchRules).To(HaveLen(1))
+			Expect(changes.PatchRules[0].Match.NullFields).To(Equal([]string{"Expr"}))
+			_, err = api.Apply(ctx, spec, policy)
+			Expect(err).NotTo(HaveOccurred())
+
+			policy, err = api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Rules[0].Match.Expr).To(BeNil())
+			Expect(policy.Rules[0].Match.Config.SrcIpRanges).To(Equal([]string{"192.168.0.0/24"}))
+			Expect(api.Diff(spec, policy).Empty()).To(BeTrue())
+		})
+
+		It("should put the rules in preview and enforce them again", func() {
+			spec.Rules[1].Preview = true
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(previews(current)).To(Equal([]bool{false, true, false}))
+
+			spec.PreviewRules = true
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+			current, err = api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(previews(current)).To(Equal([]bool{true, true, false}))
+
+			spec.PreviewRules = false
+			spec.Rules[1].Preview = false
+			changes := api.Diff(spec, current)
+			Expect(changes.Differences).To(Equal([]string{"rule 100 preview: true -> <unset>", "rule 101 preview: true -> <unset>"}))
+			b, err := json.Marshal(changes.PatchRules[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(ContainSubstring(`"preview":false`))
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+			current, err = api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(previews(current)).To(Equal([]bool{false, false, false}))
+		})
+
+		It("should patch changes of the request headers", func() {
+			spec.Rules[0].RequestHeadersToAdd = []cloudarmorv1beta1.RequestHeader{
+				{Name: "x-partner", Value: "allowlist"},
+				{Name: "x-env", Value: "prod"},
+			}
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+
+			spec.Rules[0].RequestHeadersToAdd = []cloudarmorv1beta1.RequestHeader{
+				{Name: "x-env", Value: "prod"},
+				{Name: "x-partner", Value: "allowlist"},
+			}
+			Expect(api.Diff(spec, current).Empty()).To(BeTrue())
+
+			spec.Rules[0].RequestHeadersToAdd[1].Value = "partner-a"
+			Expect(api.Diff(spec, current).PatchRules).To(HaveLen(1))
+
+			spec.Rules[0].RequestHeadersToAdd = nil
+			changes := api.Diff(spec, current)
+			Expect(changes.PatchRules).To(HaveLen(1))
+			Expect(changes.PatchRules[0].NullFields).To(Equal([]string{"HeaderAction"}))
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+			current, err = api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(current.Rules[0].HeaderAction).To(BeNil())
+		})
+
+		It("should clear the options and the WAF rule set the rules drop", func() {
+			spec.Rules[0].Action = "redirect"
+			spec.Rules[0].RedirectOptions = &cloudarmorv1beta1.RedirectOptions{Type: "GOOGLE_RECAPTCHA"}
+			spec.Rules[1].Action = "throttle"
+			spec.Rules[1].RateLimitOptions = &cloudarmorv1beta1.RateLimitOptions{
+				RateLimitThreshold: cloudarmorv1beta1.RateLimitThreshold{Count: 100, IntervalSec: 60},
+				ExceedAction:       "deny(429)",
+			}
+			spec.Rules = append(spec.Rules, cloudarmorv1beta1.SecurityPolicyRule{
+				Action:      "deny(403)",
+				Description: "rule 3",
+				Priority:    102,
+				PreconfiguredWaf: &cloudarmorv1beta1.PreconfiguredWaf{
+					RuleSet: "xss-v33-stable",
+					Exclusions: []cloudarmorv1beta1.PreconfiguredWafExclusion{{
+						RequestHeaders: []cloudarmorv1beta1.PreconfiguredWafExclusionField{{Operator: "EQUALS", Value: "x-token"}},
+					}},
+				},
+			})
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(current.Rules[2].PreconfiguredWafConfig).NotTo(BeNil())
+
+			spec.Rules[0].Action = "allow"
+			spec.Rules[0].RedirectOptions = nil
+			spec.Rules[1].Action = "allow"
+			spec.Rules[1].RateLimitOptions = nil
+			spec.Rules[2].PreconfiguredWaf = nil
+			spec.Rules[2].SrcIpRanges = []string{"192.168.2.0/24"}
+			changes := api.Diff(spec, current)
+			Expect(changes.PatchRules).To(HaveLen(3))
+			Expect(changes.PatchRules[0].NullFields).To(Equal([]string{"RedirectOptions"}))
+			Expect(changes.PatchRules[1].NullFields).To(Equal([]string{"RateLimitOptions"}))
+			Expect(changes.PatchRules[2].NullFields).To(Equal([]string{"PreconfiguredWafConfig"}))
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+
+			current, err = api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(current.Rules[0].RedirectOptions).To(BeNil())
+			Expect(current.Rules[1].RateLimitOptions).To(BeNil())
+			Expect(current.Rules[2].PreconfiguredWafConfig).To(BeNil())
+			Expect(current.Rules[2].Match.Expr).To(BeNil())
+			Expect(api.Diff(spec, current).Empty()).To(BeTrue())
+		})
+
+		It("should patch and clear the reCAPTCHA options of the policy", func() {
+			spec.Rules[0].Action = "redirect"
+			spec.Rules[0].RedirectOptions = &cloudarmorv1beta1.RedirectOptions{Type: "GOOGLE_RECAPTCHA"}
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(current.Rules[0].RedirectOptions.Type).To(Equal("GOOGLE_RECAPTCHA"))
+
+			spec.RecaptchaOptionsConfig = &cloudarmorv1beta1.RecaptchaOptionsConfig{RedirectSiteKey: "projects/p/keys/k"}
+			changes := api.Diff(spec, current)
+			Expect(changes.Policy).To(BeTrue())
+			Expect(changes.Differences).To(Equal([]string{`recaptchaOptionsConfig: <unset> -> {"redirectSiteKey":"projects/p/keys/k"}`}))
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+			current, err = api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(current.RecaptchaOptionsConfig.RedirectSiteKey).To(Equal("projects/p/keys/k"))
+
+			spec.RecaptchaOptionsConfig = nil
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+			current, err = api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(current.RecaptchaOptionsConfig).To(BeNil())
+			Expect(current.Description).To(Equal("description"))
+		})
+
+		It("should enable, patch and disable Adaptive Protection of the policy", func() {
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(api.Diff(spec, current).Empty()).To(BeTrue())
+
+			spec.AdaptiveProtection = &cloudarmorv1beta1.AdaptiveProtection{
+				Layer7DdosDefenseConfig: cloudarmorv1beta1.Layer7DdosDefenseConfig{Enable: true},
+			}
+			changes := api.Diff(spec, current)
+			Expect(changes.Policy).To(BeTrue())
+			Expect(changes.Differences).To(Equal([]string{`adaptiveProtectionConfig: <unset> -> {"layer7DdosDefenseConfig":{"enable":true,"ruleVisibility":"STANDARD"}}`}))
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+			current, err = api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(current.AdaptiveProtectionConfig.Layer7DdosDefenseConfig.Enable).To(BeTrue())
+			Expect(api.Diff(spec, current).Empty()).To(BeTrue())
+
+			spec.AdaptiveProtection.Layer7DdosDefenseConfig.RuleVisibility = "PREMIUM"
+			spec.AdaptiveProtection.Layer7DdosDefenseConfig.ThresholdConfigs = []cloudarmorv1beta1.Layer7DdosDefenseThresholdConfig{
+				{Name: "high", AutoDeployLoadThreshold: "0.8", AutoDeployConfidenceThreshold: "0.5", AutoDeployExpirationSec: 3600},
+			}
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+			current, err = api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			defense := current.AdaptiveProtectionConfig.Layer7DdosDefenseConfig
+			Expect(defense.RuleVisibility).To(Equal("PREMIUM"))
+			Expect(defense.ThresholdConfigs).To(HaveLen(1))
+			Expect(defense.ThresholdConfigs[0].AutoDeployLoadThreshold).To(Equal(0.8))
+			Expect(defense.ThresholdConfigs[0].AutoDeployExpirationSec).To(Equal(int64(3600)))
+
+			spec.AdaptiveProtection = nil
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+			current, err = api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(current.AdaptiveProtectionConfig.Layer7DdosDefenseConfig.Enable).To(BeFalse())
+			Expect(current.AdaptiveProtectionConfig.Layer7DdosDefenseConfig.ThresholdConfigs).To(BeEmpty())
+			Expect(api.Diff(spec, current).Empty()).To(BeTrue())
+		})
+
+		It("should patch and restore the advanced options of the policy", func() {
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+
+			spec.AdvancedOptionsConfig = &cloudarmorv1beta1.AdvancedOptionsConfig{
+				JsonParsing:          "STANDARD",
+				JsonCustomConfig:     &cloudarmorv1beta1.JsonCustomConfig{ContentTypes: []string{"application/vnd.api+json"}},
+				LogLevel:             "VERBOSE",
+				UserIpRequestHeaders: []string{"True-Client-IP"},
+			}
+			changes := api.Diff(spec, current)
+			Expect(changes.Policy).To(BeTrue())
+			Expect(changes.Differences).To(HaveLen(1))
+			Expect(changes.Differences[0]).To(HavePrefix("advancedOptionsConfig: <unset> -> "))
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+			current, err = api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(current.AdvancedOptionsConfig.JsonCustomConfig.ContentTypes).To(Equal([]string{"application/vnd.api+json"}))
+			Expect(current.AdvancedOptionsConfig.UserIpRequestHeaders).To(Equal([]string{"True-Client-IP"}))
+			Expect(api.Diff(spec, current).Empty()).To(BeTrue())
+
+			spec.AdvancedOptionsConfig.LogLevel = ""
+			spec.AdvancedOptionsConfig.UserIpRequestHeaders = nil
+			Expect(api.Diff(spec, current).Differences).To(Equal([]string{
+				`advancedOptionsConfig.logLevel: "VERBOSE" -> "NORMAL"`,
+				`advancedOptionsConfig.userIpRequestHeaders: ["True-Client-IP"] -> <unset>`,
+			}))
+
+			spec.AdvancedOptionsConfig = nil
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+			current, err = api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(current.AdvancedOptionsConfig.JsonParsing).To(Equal("DISABLED"))
+			Expect(current.AdvancedOptionsConfig.LogLevel).To(Equal("NORMAL"))
+			Expect(current.AdvancedOptionsConfig.JsonCustomConfig).To(BeNil())
+			Expect(current.AdvancedOptionsConfig.UserIpRequestHeaders).To(BeEmpty())
+			Expect(api.Diff(spec, current).Empty()).To(BeTrue())
+		})
+
+		It("should patch the default rule of defaultRule", func() {
+			spec.DefaultAction = "allow"
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(current.Rules[2].Action).To(Equal("allow"))
+			Expect(current.Rules[2].Description).To(Equal("This is default action"))
+
+			spec.DefaultAction = ""
+			spec.DefaultRule = &cloudarmorv1beta1.DefaultRule{
+				Action:      "throttle",
+				Description: "throttle the others",
+				Preview:     true,
+				RateLimitOptions: &cloudarmorv1beta1.RateLimitOptions{
+					RateLimitThreshold: cloudarmorv1beta1.RateLimitThreshold{Count: 1000, IntervalSec: 60},
+					ExceedAction:       "deny(429)",
+				},
+			}
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+			current, err = api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			defaultRule := current.Rules[2]
+			Expect(defaultRule.Priority).To(Equal(int64(2147483647)))
+			Expect(defaultRule.Action).To(Equal("throttle"))
+			Expect(defaultRule.Description).To(Equal("throttle the others"))
+			Expect(defaultRule.Preview).To(BeTrue())
+			Expect(defaultRule.Match.Config.SrcIpRanges).To(Equal([]string{"*"}))
+			Expect(defaultRule.RateLimitOptions.RateLimitThreshold.Count).To(Equal(int64(1000)))
+			Expect(api.Diff(spec, current).Empty()).To(BeTrue())
+		})
+
+		It("should not change the type of the policy", func() {
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+
+			spec.Type = cloudarmorv1beta1.SecurityPolicyTypeCloudArmorEdge
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).To(MatchError("type of security policy policy can not be changed from CLOUD_ARMOR to CLOUD_ARMOR_EDGE"))
+		})
+
+		It("should patch edge and network policies with the advanced options GCE returns", func() {
+			for _, policyType := range []cloudarmorv1beta1.SecurityPolicyType{
+				cloudarmorv1beta1.SecurityPolicyTypeCloudArmorEdge,
+				cloudarmorv1beta1.SecurityPolicyTypeCloudArmorNetwork,
+			} {
+				spec.Type = policyType
+				spec.Description = "description"
+				if policyType == cloudarmorv1beta1.SecurityPolicyTypeCloudArmorNetwork {
+					spec.Region = "asia-northeast1"
+					api.Backend = backend.InRegion(spec.Region)
+				}
+				_, err := api.Create(ctx, spec)
+				Expect(err).NotTo(HaveOccurred())
+				current, err := api.Get(ctx, "policy")
+				Expect(err).NotTo(HaveOccurred())
+				current.AdvancedOptionsConfig = &compute.SecurityPolicyAdvancedOptionsConfig{JsonParsing: "DISABLED", LogLevel: "NORMAL"}
+
+				spec.Description = "changed"
+				_, err = api.Apply(ctx, spec, current)
+				Expect(err).NotTo(HaveOccurred())
+				current, err = api.Get(ctx, "policy")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(current.Description).To(Equal("changed"))
+			}
+		})
+
+		It("should not call the API when nothing changed", func() {
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+
+			operation, err := api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(operation).To(BeEmpty())
+			Expect(backend.Operations()).To(HaveLen(1))
+		})
+
+		It("should return OperationError when the operation failed", func() {
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+
+			spec.Rules[0].Action = "deny(403)"
+			backend.FailNextOperation("INVALID_USAGE", "invalid rule")
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).To(BeAssignableToTypeOf(&OperationError{}))
+		})
+	})
+
+	Context("Diff", func() {
+		It("should be empty for the applied spec", func() {
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(api.Diff(spec, current).Empty()).To(BeTrue())
+		})
+
+		It("should list the changes made outside of the spec", func() {
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = backend.PatchRule(ctx, "policy", 100, &compute.SecurityPolicyRule{
+				Action:     "deny(403)",
+				Priority:   100,
+				NullFields: []string{"Description"},
+				Match: &compute.SecurityPolicyRuleMatcher{
+					VersionedExpr: "SRC_IPS_V1",
+					Config:        &compute.SecurityPolicyRuleMatcherConfig{SrcIpRanges: []string{"10.0.0.0/8"}},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = backend.RemoveRule(ctx, "policy", 101)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+
+			changes := api.Diff(spec, current)
+			Expect(changes.Empty()).To(BeFalse())
+			Expect(changes.PatchRules).To(HaveLen(1))
+			Expect(changes.AddRules).To(HaveLen(1))
+			Expect(changes.Differences).To(Equal([]string{
+				`rule 100 action: "deny(403)" -> "allow"`,
+				`rule 100 description: <unset> -> "rule 1"`,
+				`rule 100 match.config.srcIpRanges: ["10.0.0.0/8"] -> ["192.168.0.0/24"]`,
+				"rule 101: missing",
+			}))
+		})
+	})
+
+	Context("with a running operation", func() {
+		It("should wait until the operation is DONE", func() {
+			server := computetest.NewServer()
+			defer server.Close()
+			server.PendingPolls = 2
+			gce, err := NewGCESecurityPolicyBackend(ctx, testProjectID,
+				option.WithEndpoint(server.Endpoint()), option.WithoutAuthentication())
+			Expect(err).NotTo(HaveOccurred())
+			api = &SecurityPolicyAPI{Log: logf.Log, Backend: gce, PollInterval: 10 * time.Millisecond}
+
+			operation, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			op, err := gce.GetOperation(ctx, operation)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(op.Status).To(Equal("DONE"))
+		})
+	})
+
+	Context("with the compute API stand-in", func() {
+		It("should clear the fields a patched rule drops", func() {
+			server := computetest.NewServer()
+			defer server.Close()
+			gce, err := NewGCESecurityPolicyBackend(ctx, testProjectID,
+				option.WithEndpoint(server.Endpoint()), option.WithoutAuthentication())
+			Expect(err).NotTo(HaveOccurred())
+			api = &SecurityPolicyAPI{Log: logf.Log, Backend: gce, PollInterval: 10 * time.Millisecond}
+
+			spec.Rules[0].RequestHeadersToAdd = []cloudarmorv1beta1.RequestHeader{{Name: "x-env", Value: "prod"}}
+			_, err = api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			current, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+
+			spec.Rules[0].RequestHeadersToAdd = nil
+			spec.Rules[0].SrcIpRanges = nil
+			spec.Rules[0].Expression = "origin.region_code == 'RU'"
+			_, err = api.Apply(ctx, spec, current)
+			Expect(err).NotTo(HaveOccurred())
+
+			policy := server.SecurityPolicy(testProjectID, "policy")
+			Expect(policy.Rules[0].HeaderAction).To(BeNil())
+			Expect(policy.Rules[0].Match.Config).To(BeNil())
+			Expect(policy.Rules[0].Match.VersionedExpr).To(BeEmpty())
+			Expect(policy.Rules[0].Match.Expr.Expression).To(Equal("origin.region_code == 'RU'"))
+			Expect(policy.Rules[0].Description).To(Equal("rule 1"))
+		})
+	})
+
+	Context("Delete", func() {
+		It("should ignore a missing policy", func() {
+			_, err := api.Create(ctx, spec)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(api.Delete(ctx, "policy")).To(Succeed())
+			Expect(api.Delete(ctx, "policy")).To(Succeed())
+
+			policy, err := api.Get(ctx, "policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy).To(BeNil())
+		})
+	})
+})
+
+var _ = Describe("customResourceToSecurityPolicyRule", func() {
+	It("should convert a preconfigured WAF rule set to the expression and exclusions", func() {
+		sensitivity := int64(2)
+		rule := customResourceToSecurityPolicyRule(&cloudarmorv1beta1.SecurityPolicyRule{
+			Action:      "deny(403)",
+			Description: "sqli",
+			Priority:    1000,
+			PreconfiguredWaf: &cloudarmorv1beta1.PreconfiguredWaf{
+				RuleSet:       "sqli-v33-stable",
+				Sensitivity:   &sensitivity,
+				OptOutRuleIDs: []string{"owasp-crs-v030301-id942350-sqli", "owasp-crs-v030301-id942360-sqli"},
+				Exclusions: []cloudarmorv1beta1.PreconfiguredWafExclusion{{
+					TargetRuleIDs:  []string{"owasp-crs-v030301-id942100-sqli"},
+					RequestHeaders: []cloudarmorv1beta1.PreconfiguredWafExclusionField{{Operator: "EQUALS", Value: "x-token"}},
+					RequestUris:    []cloudarmorv1beta1.PreconfiguredWafExclusionField{{Operator: "STARTS_WITH", Value: "/api/"}},
+				}},
+			},
+		})
+		Expect(rule.Match.Config).To(BeNil())
+		Expect(rule.Match.Expr.Expression).To(Equal("evaluatePreconfiguredWaf('sqli-v33-stable', {'sensitivity': 2, " +
+			"'opt_out_rule_ids': ['owasp-crs-v030301-id942350-sqli', 'owasp-crs-v030301-id942360-sqli']})"))
+		Expect(rule.PreconfiguredWafConfig.Exclusions).To(HaveLen(1))
+		exclusion := rule.PreconfiguredWafConfig.Exclusions[0]
+		Expect(exclusion.TargetRuleSet).To(Equal("sqli-v33-stable"))
+		Expect(exclusion.TargetRuleIds).To(Equal([]string{"owasp-crs-v030301-id942100-sqli"}))
+		Expect(exclusion.RequestHeadersToExclude[0].Val).To(Equal("x-token"))
+		Expect(exclusion.RequestUrisToExclude[0].Op).To(Equal("STARTS_WITH"))
+		Expect(exclusion.RequestCookiesToExclude).To(BeNil())
+	})
+
+	It("should convert a rule set without options", func() {
+		rule := customResourceToSecurityPolicyRule(&cloudarmorv1beta1.SecurityPolicyRule{
+			Action:           "deny(403)",
+			Priority:         1001,
+			PreconfiguredWaf: &cloudarmorv1beta1.PreconfiguredWaf{RuleSet: "xss-v33-stable"},
+		})
+		Expect(rule.Match.Expr.Expression).To(Equal("evaluatePreconfiguredWaf('xss-v33-stable')"))
+		Expect(rule.PreconfiguredWafConfig).To(BeNil())
+	})
+})
+
+var _ = Describe("FakeSecurityPolicyBackend", func() {
+	It("should reject a stale fingerprint", func() {
+		ctx := context.Background()
+		backend := NewFakeSecurityPolicyBackend()
+		_, err := backend.Insert(ctx, &compute.SecurityPolicy{Name: "policy"})
+		Expect(err).NotTo(HaveOccurred())
+		policy, err := backend.Get(ctx, "policy")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = backend.Patch(ctx, "policy", &compute.SecurityPolicy{Description: "first", Fingerprint: policy.Fingerprint})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = backend.Patch(ctx, "policy", &compute.SecurityPolicy{Description: "second", Fingerprint: policy.Fingerprint})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+func priorities(policy *compute.SecurityPolicy) []int64 {
+	result := []int64{}
+	for _, rule := range policy.Rules {
+		result = append(result, rule.Priority)
+	}
+	return result
+}
+
+func previews(policy *compute.SecurityPolicy) []bool {
+	result := []bool{}
+	for _, rule := range policy.Rules {
+		result = append(result, rule.Preview)
+	}
+	return result
+}
@@ -17,57 +17,218 @@ package controllers
 
 import (
 	"context"
-	"sort"
+	"fmt"
+	"net"
+	"strings"
+	"unicode"
 
 	"github.com/go-logr/logr"
 	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	// taintNodeUnschedulable is the taint of the cordoned nodes.
+	taintNodeUnschedulable = "node.kubernetes.io/unschedulable"
+	// taintToBeDeletedByClusterAutoscaler is the taint of the nodes the cluster autoscaler is scaling down.
+	taintToBeDeletedByClusterAutoscaler = "ToBeDeletedByClusterAutoscaler"
+)
+
 type NodeCalculator struct {
 	Log        logr.Logger
 	Reconciler *SecurityPolicyReconciler
+	// Namespace is the namespace of the security policy, where the ConfigMaps of addressSource are read.
+	Namespace string
 }
 
-func (n *NodeCalculator) Calculate(instance *cloudarmorv1beta1.SecurityPolicy) (*cloudarmorv1beta1.SecurityPolicy, error) {
-	for i, rule := range instance.Status.Rules {
-		if rule.NodePoolSelectors == nil {
+// Calculate returns the desired state of the spec, with SrcIpRanges of nodePoolSelectors rules resolved.
+// The spec is not modified.
+func (n *NodeCalculator) Calculate(spec *cloudarmorv1beta1.SecurityPolicySpec) (*cloudarmorv1beta1.SecurityPolicySpec, error) {
+	desired := spec.DeepCopy()
+	for i, rule := range desired.Rules {
+		if len(rule.NodePoolSelectors) == 0 {
 			continue
 		}
-		labels := map[string]string{}
-		for _, selector := range rule.NodePoolSelectors {
-			labels[selector.Key] = selector.Value
+		selector, err := rule.NodeSelector()
+		if err != nil {
+			return nil, err
 		}
-		addresses, err := n.List(labels)
+		addresses, err := n.List(selector, rule.AddressSource, rule.NodeFilter)
 		if err != nil {
 			return nil, err
 		}
-		instance.Status.Rules[i].SrcIpRanges = addresses
+		desired.Rules[i].SrcIpRanges = addresses
 	}
-	return instance, nil
+	return desired, nil
 }
 
-// List is returned node external ip list.
-func (n *NodeCalculator) List(labels map[string]string) ([]string, error) {
+// List returns the addresses of the nodes the selector selects and the filter passes, from the source,
+// as /32 or /128 ranges. A nil source is ExternalIP, and a nil filter passes all the nodes.
+func (n *NodeCalculator) List(selector labels.Selector, source *cloudarmorv1beta1.AddressSource, filter *cloudarmorv1beta1.NodeFilter) ([]string, error) {
 	log := n.Log.WithValues("gcp_securitypolicy", "node_handler")
 	log.Info("Node Address List")
 	ctx := context.Background()
 	addresses := []string{}
 
 	nodelist := &corev1.NodeList{}
-	filter := client.MatchingLabels(labels)
-	err := n.Reconciler.List(ctx, nodelist, filter)
+	matchingLabels := func(opts *client.ListOptions) {
+		opts.LabelSelector = selector
+	}
+	err := n.Reconciler.List(ctx, nodelist, matchingLabels)
 	if err != nil {
 		return addresses, err
 	}
+	nodes := make([]corev1.Node, 0, len(nodelist.Items))
 	for _, node := range nodelist.Items {
-		for _, address := range node.Status.Addresses {
-			if address.Type == corev1.NodeExternalIP {
-				addresses = append(addresses, address.Address)
+		if nodeFilterPasses(filter, &node) {
+			nodes = append(nodes, node)
+		}
+	}
+	if source == nil {
+		source = &cloudarmorv1beta1.AddressSource{Type: cloudarmorv1beta1.AddressSourceExternalIP}
+	}
+
+	var ips []string
+	switch source.Type {
+	case cloudarmorv1beta1.AddressSourceConfigMap:
+		if len(nodes) > 0 {
+			ips, err = n.configMapAddresses(ctx, source.ConfigMapKeyRef)
+			if err != nil {
+				return addresses, err
+			}
+		}
+	case cloudarmorv1beta1.AddressSourceAnnotation:
+		for _, node := range nodes {
+			ips = append(ips, splitAddresses(node.Annotations[source.Annotation])...)
+		}
+	default:
+		for _, node := range nodes {
+			for _, address := range node.Status.Addresses {
+				if nodeAddressMatches(source.Type, address) {
+					ips = append(ips, address.Address)
+				}
 			}
 		}
 	}
-	sort.Strings(addresses)
-	return addresses, nil
+
+	ranges := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		r, err := addressToIPRange(ip)
+		if err != nil {
+			return addresses, err
+		}
+		ranges = append(ranges, r)
+	}
+	return append(addresses, canonicalIPRanges(ranges)...), nil
+}
+
+// configMapAddresses returns the addresses in the key of the ConfigMap.
+// A missing ConfigMap or key is an error unless the reference is optional.
+func (n *NodeCalculator) configMapAddresses(ctx context.Context, ref *corev1.ConfigMapKeySelector) ([]string, error) {
+	optional := ref.Optional != nil && *ref.Optional
+	configMap := &corev1.ConfigMap{}
+	if err := n.Reconciler.configMapReader().Get(ctx, types.NamespacedName{Namespace: n.Namespace, Name: ref.Name}, configMap); err != nil {
+		if apierrs.IsNotFound(err) && optional {
+			return nil, nil
+		}
+		return nil, err
+	}
+	value, ok := configMap.Data[ref.Key]
+	if !ok && !optional {
+		return nil, fmt.Errorf("key %q is not found in ConfigMap %s/%s", ref.Key, n.Namespace, ref.Name)
+	}
+	return splitAddresses(value), nil
+}
+
+// configMapReader returns the reader of the ConfigMaps of addressSource.
+func (r *SecurityPolicyReconciler) configMapReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// nodeFilterPasses returns true if the node is in the state the filter requires.
+func nodeFilterPasses(filter *cloudarmorv1beta1.NodeFilter, node *corev1.Node) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.ReadyOnly && !nodeReady(node) {
+		return false
+	}
+	if filter.ExcludeUnschedulable && (nodeUnschedulable(node) || nodeDeleting(node)) {
+		return false
+	}
+	return true
+}
+
+// nodeReady returns true if the Ready condition of the node is True.
+func nodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// nodeUnschedulable returns true if the node is cordoned.
+func nodeUnschedulable(node *corev1.Node) bool {
+	return node.Spec.Unschedulable || hasTaint(node, taintNodeUnschedulable)
+}
+
+// nodeDeleting returns true if the node is being deleted, or the cluster autoscaler is scaling it down.
+func nodeDeleting(node *corev1.Node) bool {
+	return node.DeletionTimestamp != nil || hasTaint(node, taintToBeDeletedByClusterAutoscaler)
+}
+
+func hasTaint(node *corev1.Node, key string) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeAddressMatches returns true if the address of a node is of the source type.
+func nodeAddressMatches(sourceType cloudarmorv1beta1.AddressSourceType, address corev1.NodeAddress) bool {
+	switch sourceType {
+	case cloudarmorv1beta1.AddressSourceInternalIP:
+		return address.Type == corev1.NodeInternalIP
+	case cloudarmorv1beta1.AddressSourceIPv6:
+		if address.Type != corev1.NodeExternalIP && address.Type != corev1.NodeInternalIP {
+			return false
+		}
+		ip := net.ParseIP(address.Address)
+		return ip != nil && ip.To4() == nil
+	default:
+		return address.Type == corev1.NodeExternalIP
+	}
+}
+
+// splitAddresses splits comma or whitespace separated addresses.
+func splitAddresses(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// addressToIPRange returns the IP as a /32 or /128 range. A range is returned as is.
+func addressToIPRange(address string) (string, error) {
+	if _, ipNet, err := net.ParseCIDR(address); err == nil {
+		return ipNet.String(), nil
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", fmt.Errorf("invalid node address %q", address)
+	}
+	if ip.To4() != nil {
+		return ip.String() + "/32", nil
+	}
+	return ip.String() + "/128", nil
 }
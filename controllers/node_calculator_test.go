@@ -0,0 +1,167 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("NodeCalculator", func() {
+	var spec *cloudarmorv1beta1.SecurityPolicySpec
+
+	calculator := func(objs ...runtime.Object) *NodeCalculator {
+		nodes := []runtime.Object{
+			&corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "node-1",
+					Labels:      map[string]string{"pool": "default"},
+					Annotations: map[string]string{"example.com/egress-ips": "198.51.100.1, 198.51.100.2"},
+				},
+				Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+					{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+					{Type: corev1.NodeInternalIP, Address: "fd00::1"},
+					{Type: corev1.NodeExternalIP, Address: "203.0.113.1"},
+					{Type: corev1.NodeExternalIP, Address: "2001:db8::1"},
+					{Type: corev1.NodeHostName, Address: "node-1"},
+				}},
+			},
+			&corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-2", Labels: map[string]string{"pool": "spot"}},
+				Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+					{Type: corev1.NodeExternalIP, Address: "203.0.113.2"},
+				}},
+			},
+		}
+		reconciler := &SecurityPolicyReconciler{Client: fake.NewFakeClient(append(nodes, objs...)...)}
+		return &NodeCalculator{Log: logf.Log, Reconciler: reconciler, Namespace: "default"}
+	}
+
+	BeforeEach(func() {
+		spec = &cloudarmorv1beta1.SecurityPolicySpec{
+			Name:          "policy",
+			Description:   "description",
+			DefaultAction: "deny(403)",
+			Rules: []cloudarmorv1beta1.SecurityPolicyRule{
+				{Action: "allow", Description: "nodes", Priority: 100, NodePoolSelectors: []cloudarmorv1beta1.LabelSelectors{{Key: "pool", Value: "default"}}},
+			},
+		}
+	})
+
+	resolve := func(n *NodeCalculator, source *cloudarmorv1beta1.AddressSource) []string {
+		spec.Rules[0].AddressSource = source
+		desired, err := n.Calculate(spec)
+		Expect(err).NotTo(HaveOccurred())
+		return desired.Rules[0].SrcIpRanges
+	}
+
+	It("should resolve the external IPs of the selected nodes by default", func() {
+		Expect(resolve(calculator(), nil)).To(Equal([]string{"2001:db8::1/128", "203.0.113.1/32"}))
+	})
+
+	It("should resolve the addresses of the source type", func() {
+		n := calculator()
+		Expect(resolve(n, &cloudarmorv1beta1.AddressSource{Type: cloudarmorv1beta1.AddressSourceInternalIP})).To(Equal([]string{"10.0.0.1/32", "fd00::1/128"}))
+		Expect(resolve(n, &cloudarmorv1beta1.AddressSource{Type: cloudarmorv1beta1.AddressSourceIPv6})).To(Equal([]string{"2001:db8::1/128", "fd00::1/128"}))
+		Expect(resolve(n, &cloudarmorv1beta1.AddressSource{
+			Type:       cloudarmorv1beta1.AddressSourceAnnotation,
+			Annotation: "example.com/egress-ips",
+		})).To(Equal([]string{"198.51.100.1/32", "198.51.100.2/32"}))
+	})
+
+	It("should resolve the NAT IPs of the ConfigMap while the nodes are selected", func() {
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cloud-nat"},
+			Data:       map[string]string{"ips": "198.51.100.10\n198.51.100.11\n"},
+		}
+		n := calculator(configMap)
+		source := &cloudarmorv1beta1.AddressSource{
+			Type: cloudarmorv1beta1.AddressSourceConfigMap,
+			ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "cloud-nat"},
+				Key:                  "ips",
+			},
+		}
+		Expect(resolve(n, source)).To(Equal([]string{"198.51.100.10/32", "198.51.100.11/32"}))
+
+		spec.Rules[0].NodePoolSelectors[0].Value = "none"
+		Expect(resolve(n, source)).To(BeEmpty())
+
+		spec.Rules[0].NodePoolSelectors[0].Value = "default"
+		source.ConfigMapKeyRef.Key = "missing"
+		_, err := n.Calculate(spec)
+		Expect(err).To(MatchError(`key "missing" is not found in ConfigMap default/cloud-nat`))
+	})
+
+	It("should read the ConfigMap through the API reader", func() {
+		n := calculator()
+		n.Reconciler.APIReader = fake.NewFakeClient(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cloud-nat"},
+			Data:       map[string]string{"ips": "198.51.100.10"},
+		})
+		Expect(resolve(n, &cloudarmorv1beta1.AddressSource{
+			Type: cloudarmorv1beta1.AddressSourceConfigMap,
+			ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "cloud-nat"},
+				Key:                  "ips",
+			},
+		})).To(Equal([]string{"198.51.100.10/32"}))
+	})
+
+	It("should reject an annotation which is not an IP", func() {
+		spec.Rules[0].AddressSource = &cloudarmorv1beta1.AddressSource{Type: cloudarmorv1beta1.AddressSourceAnnotation, Annotation: "example.com/egress-ips"}
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:        "node-3",
+			Labels:      map[string]string{"pool": "default"},
+			Annotations: map[string]string{"example.com/egress-ips": "nat.example.com"},
+		}}
+		_, err := calculator(node).Calculate(spec)
+		Expect(err).To(MatchError(`invalid node address "nat.example.com"`))
+	})
+
+	It("should filter out the nodes which are not ready, cordoned or being deleted", func() {
+		ready := []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}
+		notReady := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-3", Labels: map[string]string{"pool": "default"}},
+			Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeExternalIP, Address: "203.0.113.3"}}},
+		}
+		cordoned := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-4", Labels: map[string]string{"pool": "default"}},
+			Spec:       corev1.NodeSpec{Unschedulable: true},
+			Status:     corev1.NodeStatus{Conditions: ready, Addresses: []corev1.NodeAddress{{Type: corev1.NodeExternalIP, Address: "203.0.113.4"}}},
+		}
+		scalingDown := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-5", Labels: map[string]string{"pool": "default"}},
+			Spec:       corev1.NodeSpec{Taints: []corev1.Taint{{Key: "ToBeDeletedByClusterAutoscaler", Effect: corev1.TaintEffectNoSchedule}}},
+			Status:     corev1.NodeStatus{Conditions: ready, Addresses: []corev1.NodeAddress{{Type: corev1.NodeExternalIP, Address: "203.0.113.5"}}},
+		}
+		n := calculator(notReady, cordoned, scalingDown)
+		Expect(resolve(n, nil)).To(Equal([]string{"2001:db8::1/128", "203.0.113.1/32", "203.0.113.3/32", "203.0.113.4/32", "203.0.113.5/32"}))
+
+		spec.Rules[0].NodeFilter = &cloudarmorv1beta1.NodeFilter{ExcludeUnschedulable: true}
+		Expect(resolve(n, nil)).To(Equal([]string{"2001:db8::1/128", "203.0.113.1/32", "203.0.113.3/32"}))
+
+		spec.Rules[0].NodeFilter.ReadyOnly = true
+		Expect(resolve(n, nil)).To(BeEmpty())
+	})
+})
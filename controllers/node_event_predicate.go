@@ -16,10 +16,25 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
+	"reflect"
+	"sort"
+
+	"github.com/go-logr/logr"
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
+// annotationKeyIndex is the field index of SecurityPolicy by the node annotations its addressSource reads.
+const annotationKeyIndex = "spec.rules.addressSource.annotation"
+
+// NodeEventPredicate passes the node events which can change the addresses of nodePoolSelectors.
 type NodeEventPredicate struct {
+	client.Client
+	Log logr.Logger
 }
 
 // Create returns true if the Create event should be processed
@@ -32,8 +47,34 @@ func (p *NodeEventPredicate) Delete(event.DeleteEvent) bool {
 	return true
 }
 
-// Update returns true if the Update event should be processed
-func (p *NodeEventPredicate) Update(event.UpdateEvent) bool {
+// Update returns true if the addresses, readiness, schedulability or labels of the node changed,
+// or an annotation which addressSource of a security policy reads.
+// Heartbeats, which only renew the conditions and the resource version, are filtered out.
+func (p *NodeEventPredicate) Update(e event.UpdateEvent) bool {
+	oldNode, ok := e.ObjectOld.(*corev1.Node)
+	if !ok {
+		return false
+	}
+	newNode, ok := e.ObjectNew.(*corev1.Node)
+	if !ok {
+		return false
+	}
+	if !reflect.DeepEqual(nodeAddresses(oldNode), nodeAddresses(newNode)) {
+		return true
+	}
+	// the states nodeFilter filters the nodes by.
+	if nodeReady(oldNode) != nodeReady(newNode) || nodeUnschedulable(oldNode) != nodeUnschedulable(newNode) || nodeDeleting(oldNode) != nodeDeleting(newNode) {
+		return true
+	}
+	if !labelsEqual(oldNode.Labels, newNode.Labels) {
+		return true
+	}
+	// annotations may hold the egress NAT IPs of addressSource.
+	for _, key := range changedKeys(oldNode.Annotations, newNode.Annotations) {
+		if p.annotationRead(newNode, key) {
+			return true
+		}
+	}
 	return false
 }
 
@@ -41,3 +82,84 @@ func (p *NodeEventPredicate) Update(event.UpdateEvent) bool {
 func (p *NodeEventPredicate) Generic(event.GenericEvent) bool {
 	return false
 }
+
+// annotationRead returns true if addressSource of a security policy reads the annotation key.
+// The event is passed when the policies can not be listed, so that the change is not lost.
+func (p *NodeEventPredicate) annotationRead(node *corev1.Node, key string) bool {
+	policies := &cloudarmorv1beta1.SecurityPolicyList{}
+	if err := p.List(context.Background(), policies, client.MatchingField(annotationKeyIndex, key)); err != nil {
+		p.Log.Error(err, "unable to list security policies", "node", node.Name, "annotation", key)
+		return true
+	}
+	for _, policy := range policies.Items {
+		if containsString(annotationKeys(&policy.Spec), key) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexAnnotationKeys returns the annotation keys of addressSource for annotationKeyIndex.
+func indexAnnotationKeys(obj runtime.Object) []string {
+	policy, ok := obj.(*cloudarmorv1beta1.SecurityPolicy)
+	if !ok {
+		return nil
+	}
+	return annotationKeys(&policy.Spec)
+}
+
+// annotationKeys returns the node annotations the nodePoolSelectors rules of spec read their addresses from.
+func annotationKeys(spec *cloudarmorv1beta1.SecurityPolicySpec) []string {
+	var keys []string
+	for _, rule := range spec.Rules {
+		source := rule.AddressSource
+		if len(rule.NodePoolSelectors) == 0 || source == nil || source.Type != cloudarmorv1beta1.AddressSourceAnnotation || source.Annotation == "" {
+			continue
+		}
+		if !containsString(keys, source.Annotation) {
+			keys = append(keys, source.Annotation)
+		}
+	}
+	return keys
+}
+
+// nodeAddresses returns the addresses of node in the form of "type/address", sorted.
+// The order of the addresses reported by the kubelet does not matter.
+func nodeAddresses(node *corev1.Node) []string {
+	addresses := make([]string, 0, len(node.Status.Addresses))
+	for _, address := range node.Status.Addresses {
+		addresses = append(addresses, string(address.Type)+"/"+address.Address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// changedKeys returns the keys which are added, removed or changed from a to b, sorted.
+func changedKeys(a, b map[string]string) []string {
+	var keys []string
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			keys = append(keys, key)
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelsEqual returns true if a and b have the same labels or annotations. nil and empty are the same.
+func labelsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
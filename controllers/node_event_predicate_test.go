@@ -0,0 +1,124 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("NodeEventPredicate", func() {
+	var (
+		predicate *NodeEventPredicate
+		oldNode   *corev1.Node
+	)
+
+	BeforeEach(func() {
+		Expect(cloudarmorv1beta1.AddToScheme(scheme.Scheme)).To(Succeed())
+		policy := &cloudarmorv1beta1.SecurityPolicy{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "egress"},
+			Spec: cloudarmorv1beta1.SecurityPolicySpec{Rules: []cloudarmorv1beta1.SecurityPolicyRule{{
+				Priority:          100,
+				NodePoolSelectors: []cloudarmorv1beta1.LabelSelectors{{Key: "pool", Value: "default"}},
+				AddressSource:     &cloudarmorv1beta1.AddressSource{Type: cloudarmorv1beta1.AddressSourceAnnotation, Annotation: "example.com/egress-ips"},
+			}}},
+		}
+		predicate = &NodeEventPredicate{
+			Client: &indexedClient{
+				Client:  fake.NewFakeClientWithScheme(scheme.Scheme, policy),
+				indexes: map[string]client.IndexerFunc{annotationKeyIndex: indexAnnotationKeys},
+			},
+			Log: logf.Log,
+		}
+		oldNode = &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1", ResourceVersion: "1", Labels: map[string]string{"pool": "default"}},
+			Status: corev1.NodeStatus{
+				Addresses: []corev1.NodeAddress{
+					{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+					{Type: corev1.NodeExternalIP, Address: "203.0.113.1"},
+				},
+				Conditions: []corev1.NodeCondition{
+					{Type: corev1.NodeReady, Status: corev1.ConditionTrue, LastHeartbeatTime: metav1.Unix(0, 0)},
+				},
+			},
+		}
+	})
+
+	update := func(newNode *corev1.Node) bool {
+		return predicate.Update(event.UpdateEvent{MetaOld: oldNode, ObjectOld: oldNode, MetaNew: newNode, ObjectNew: newNode})
+	}
+
+	It("should filter out heartbeats", func() {
+		newNode := oldNode.DeepCopy()
+		newNode.ResourceVersion = "2"
+		newNode.Status.Conditions[0].LastHeartbeatTime = metav1.Unix(60, 0)
+		newNode.Status.Addresses[0], newNode.Status.Addresses[1] = newNode.Status.Addresses[1], newNode.Status.Addresses[0]
+		Expect(update(newNode)).To(BeFalse())
+	})
+
+	It("should pass a new or lost external IP", func() {
+		newNode := oldNode.DeepCopy()
+		newNode.Status.Addresses[1].Address = "203.0.113.2"
+		Expect(update(newNode)).To(BeTrue())
+
+		newNode.Status.Addresses = newNode.Status.Addresses[:1]
+		Expect(update(newNode)).To(BeTrue())
+	})
+
+	It("should pass a node moved into or out of a pool", func() {
+		newNode := oldNode.DeepCopy()
+		newNode.Labels["pool"] = "spot"
+		Expect(update(newNode)).To(BeTrue())
+
+		newNode.Labels = nil
+		Expect(update(newNode)).To(BeTrue())
+	})
+
+	It("should pass a change of the annotations addressSource reads", func() {
+		newNode := oldNode.DeepCopy()
+		newNode.Annotations = map[string]string{"example.com/egress-ips": "198.51.100.1"}
+		Expect(update(newNode)).To(BeTrue())
+
+		oldNode = newNode.DeepCopy()
+		newNode.Annotations = nil
+		Expect(update(newNode)).To(BeTrue())
+	})
+
+	It("should filter out a change of the other annotations", func() {
+		newNode := oldNode.DeepCopy()
+		newNode.Annotations = map[string]string{"node.alpha.kubernetes.io/ttl": "0"}
+		Expect(update(newNode)).To(BeFalse())
+	})
+
+	It("should pass a node which becomes not ready or cordoned", func() {
+		newNode := oldNode.DeepCopy()
+		newNode.Status.Conditions[0].Status = corev1.ConditionUnknown
+		Expect(update(newNode)).To(BeTrue())
+
+		newNode = oldNode.DeepCopy()
+		newNode.Spec.Unschedulable = true
+		Expect(update(newNode)).To(BeTrue())
+	})
+})
@@ -0,0 +1,133 @@
+/*
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// nodePoolSelectorKeyIndex is the field index of SecurityPolicy by the label keys of nodePoolSelectors.
+const nodePoolSelectorKeyIndex = "spec.rules.nodePoolSelectors.key"
+
+// nodePoolSelectorAnyKey is indexed for the rules which can select nodes without any of their keys,
+// such as the rules of only NotIn and DoesNotExist. It is never a label key.
+const nodePoolSelectorAnyKey = "*"
+
+// SecurityPolicyNodeMapper maps node events to the security policies which select the node.
+type SecurityPolicyNodeMapper struct {
+	client.Client
+	Log logr.Logger
+}
+
+// Map returns the requests of the security policies whose nodePoolSelectors match the labels of the node.
+// Update events are mapped with both of the old and the new node, so that a node moved out of a pool
+// updates the policies selecting the pool too.
+func (m *SecurityPolicyNodeMapper) Map(obj handler.MapObject) []reconcile.Request {
+	ctx := context.Background()
+	log := m.Log.WithValues("node", obj.Meta.GetName())
+
+	nodeLabels := obj.Meta.GetLabels()
+	keys := []string{nodePoolSelectorAnyKey}
+	for key := range nodeLabels {
+		keys = append(keys, key)
+	}
+	seen := map[types.NamespacedName]bool{}
+	var requests []reconcile.Request
+	for _, key := range keys {
+		policies := &cloudarmorv1beta1.SecurityPolicyList{}
+		if err := m.List(ctx, policies, client.MatchingField(nodePoolSelectorKeyIndex, key)); err != nil {
+			log.Error(err, "unable to list security policies", "key", key)
+			continue
+		}
+		for _, policy := range policies.Items {
+			name := types.NamespacedName{Namespace: policy.Namespace, Name: policy.Name}
+			if seen[name] || !selectsNode(&policy.Spec, nodeLabels) {
+				continue
+			}
+			seen[name] = true
+			requests = append(requests, reconcile.Request{NamespacedName: name})
+		}
+	}
+	return requests
+}
+
+// indexNodePoolSelectorKeys returns the label keys of nodePoolSelectors for nodePoolSelectorKeyIndex.
+// A node a rule selects has all the keys of its Equals, In and Exists requirements, so the rule is indexed by them.
+// The rule without such requirements is indexed by nodePoolSelectorAnyKey.
+func indexNodePoolSelectorKeys(obj runtime.Object) []string {
+	policy, ok := obj.(*cloudarmorv1beta1.SecurityPolicy)
+	if !ok {
+		return nil
+	}
+	seen := map[string]bool{}
+	var keys []string
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, rule := range policy.Spec.Rules {
+		if len(rule.NodePoolSelectors) == 0 {
+			continue
+		}
+		selector, err := rule.NodeSelector()
+		if err != nil {
+			continue
+		}
+		requirements, _ := selector.Requirements()
+		required := false
+		for _, requirement := range requirements {
+			switch requirement.Operator() {
+			case selection.Equals, selection.DoubleEquals, selection.In, selection.Exists:
+				add(requirement.Key())
+				required = true
+			}
+		}
+		if !required {
+			add(nodePoolSelectorAnyKey)
+		}
+	}
+	return keys
+}
+
+// selectsNode returns true if a rule of spec selects the node of nodeLabels.
+// The selectors of a rule are ANDed, as NodeCalculator lists the nodes.
+func selectsNode(spec *cloudarmorv1beta1.SecurityPolicySpec, nodeLabels map[string]string) bool {
+	for _, rule := range spec.Rules {
+		if len(rule.NodePoolSelectors) == 0 {
+			continue
+		}
+		selector, err := rule.NodeSelector()
+		if err != nil {
+			continue
+		}
+		if selector.Matches(labels.Set(nodeLabels)) {
+			return true
+		}
+	}
+	return false
+}
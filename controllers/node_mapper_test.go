@@ -0,0 +1,202 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// indexedClient filters the lists of the fake client by the field indexes, as the cache of the manager does.
+// The fake client ignores field selectors.
+type indexedClient struct {
+	client.Client
+	indexes map[string]client.IndexerFunc
+}
+
+func (c *indexedClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOptionFunc) error {
+	if err := c.Client.List(ctx, list, opts...); err != nil {
+		return err
+	}
+	listOpts := client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if listOpts.FieldSelector == nil {
+		return nil
+	}
+	objs, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	var filtered []runtime.Object
+	for _, obj := range objs {
+		matches := true
+		for _, requirement := range listOpts.FieldSelector.Requirements() {
+			index, ok := c.indexes[requirement.Field]
+			if !ok {
+				return fmt.Errorf("index %s is not registered", requirement.Field)
+			}
+			matches = matches && containsString(index(obj), requirement.Value)
+		}
+		if matches {
+			filtered = append(filtered, obj)
+		}
+	}
+	return meta.SetList(list, filtered)
+}
+
+var _ = Describe("SecurityPolicyNodeMapper", func() {
+	var policy *cloudarmorv1beta1.SecurityPolicy
+
+	BeforeEach(func() {
+		policy = &cloudarmorv1beta1.SecurityPolicy{
+			Spec: cloudarmorv1beta1.SecurityPolicySpec{
+				Rules: []cloudarmorv1beta1.SecurityPolicyRule{
+					{Action: "allow", Priority: 100, SrcIpRanges: []string{"192.168.0.0/24"}},
+					{Action: "allow", Priority: 101, NodePoolSelectors: []cloudarmorv1beta1.LabelSelectors{
+						{Key: "pool", Value: "default"},
+						{Key: "zone", Value: "a"},
+					}},
+					{Action: "allow", Priority: 102, NodePoolSelectors: []cloudarmorv1beta1.LabelSelectors{{Key: "pool", Value: "spot"}}},
+				},
+			},
+		}
+	})
+
+	It("should index the label keys of the selectors", func() {
+		Expect(indexNodePoolSelectorKeys(policy)).To(Equal([]string{"pool", "zone"}))
+	})
+
+	It("should select the node only when all the selectors of a rule match", func() {
+		Expect(selectsNode(&policy.Spec, map[string]string{"pool": "default", "zone": "a"})).To(BeTrue())
+		Expect(selectsNode(&policy.Spec, map[string]string{"pool": "default", "zone": "b"})).To(BeFalse())
+		Expect(selectsNode(&policy.Spec, map[string]string{"pool": "spot"})).To(BeTrue())
+		Expect(selectsNode(&policy.Spec, nil)).To(BeFalse())
+	})
+
+	It("should index the rules which can select nodes without their keys by the wildcard", func() {
+		policy.Spec.Rules[2].NodePoolSelectors = []cloudarmorv1beta1.LabelSelectors{{
+			LabelSelector: metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "spot", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"true"}},
+				},
+			},
+		}}
+		Expect(indexNodePoolSelectorKeys(policy)).To(Equal([]string{"pool", "zone", nodePoolSelectorAnyKey}))
+	})
+
+	It("should select the node by the expressions of the label selectors", func() {
+		policy.Spec.Rules[2].NodePoolSelectors = []cloudarmorv1beta1.LabelSelectors{{
+			LabelSelector: metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "pool", Operator: metav1.LabelSelectorOpIn, Values: []string{"a", "b"}},
+					{Key: "spot", Operator: metav1.LabelSelectorOpDoesNotExist},
+				},
+			},
+		}}
+		Expect(selectsNode(&policy.Spec, map[string]string{"pool": "b"})).To(BeTrue())
+		Expect(selectsNode(&policy.Spec, map[string]string{"pool": "b", "spot": "true"})).To(BeFalse())
+		Expect(selectsNode(&policy.Spec, map[string]string{"pool": "c"})).To(BeFalse())
+	})
+
+	Context("Map", func() {
+		var mapper *SecurityPolicyNodeMapper
+
+		newPolicy := func(name string, selector cloudarmorv1beta1.LabelSelectors) *cloudarmorv1beta1.SecurityPolicy {
+			return &cloudarmorv1beta1.SecurityPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec: cloudarmorv1beta1.SecurityPolicySpec{
+					Rules: []cloudarmorv1beta1.SecurityPolicyRule{
+						{Action: "allow", Priority: 100, NodePoolSelectors: []cloudarmorv1beta1.LabelSelectors{selector}},
+					},
+				},
+			}
+		}
+		newNode := func(nodeLabels map[string]string) *corev1.Node {
+			return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: nodeLabels}}
+		}
+		request := func(name string) reconcile.Request {
+			return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}}
+		}
+
+		BeforeEach(func() {
+			Expect(cloudarmorv1beta1.AddToScheme(scheme.Scheme)).To(Succeed())
+			mapper = &SecurityPolicyNodeMapper{
+				Client: &indexedClient{
+					Client: fake.NewFakeClientWithScheme(scheme.Scheme,
+						newPolicy("default-pool", cloudarmorv1beta1.LabelSelectors{Key: "pool", Value: "default"}),
+						newPolicy("spot-pool", cloudarmorv1beta1.LabelSelectors{Key: "pool", Value: "spot"}),
+						newPolicy("not-spot", cloudarmorv1beta1.LabelSelectors{LabelSelector: metav1.LabelSelector{
+							MatchExpressions: []metav1.LabelSelectorRequirement{
+								{Key: "spot", Operator: metav1.LabelSelectorOpDoesNotExist},
+							},
+						}}),
+					),
+					indexes: map[string]client.IndexerFunc{nodePoolSelectorKeyIndex: indexNodePoolSelectorKeys},
+				},
+				Log: logf.Log,
+			}
+		})
+
+		It("should map a node to the policies selecting its labels", func() {
+			node := newNode(map[string]string{"pool": "default"})
+			Expect(mapper.Map(handler.MapObject{Meta: node, Object: node})).To(ConsistOf(request("default-pool"), request("not-spot")))
+		})
+
+		It("should map a node without the indexed keys through the wildcard index", func() {
+			node := newNode(nil)
+			Expect(mapper.Map(handler.MapObject{Meta: node, Object: node})).To(ConsistOf(request("not-spot")))
+
+			node = newNode(map[string]string{"pool": "spot", "spot": "true"})
+			Expect(mapper.Map(handler.MapObject{Meta: node, Object: node})).To(ConsistOf(request("spot-pool")))
+		})
+
+		It("should map a node moved between pools to the policies of the old and the new labels", func() {
+			oldNode := newNode(map[string]string{"pool": "default"})
+			newNode := newNode(map[string]string{"pool": "spot", "spot": "true"})
+			queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+			defer queue.ShutDown()
+			(&handler.EnqueueRequestsFromMapFunc{ToRequests: mapper}).Update(event.UpdateEvent{
+				MetaOld: oldNode, ObjectOld: oldNode, MetaNew: newNode, ObjectNew: newNode,
+			}, queue)
+
+			var requests []reconcile.Request
+			for queue.Len() > 0 {
+				item, _ := queue.Get()
+				requests = append(requests, item.(reconcile.Request))
+				queue.Done(item)
+			}
+			Expect(requests).To(ConsistOf(request("default-pool"), request("not-spot"), request("spot-pool")))
+		})
+	})
+})
@@ -0,0 +1,84 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+)
+
+// maxSrcIpRanges is the number of srcIpRanges a SRC_IPS_V1 matcher of Cloud Armor allows.
+const maxSrcIpRanges = 10
+
+// PriorityConflictError is returned when a split rule needs a priority another rule uses.
+type PriorityConflictError struct {
+	Priority     int64
+	Conflict     int64
+	SrcIpRanges  int
+	LastPriority int64
+}
+
+func (e *PriorityConflictError) Error() string {
+	return fmt.Sprintf("rule %d needs priorities %d-%d for %d srcIpRanges, but priority %d is used",
+		e.Priority, e.Priority, e.LastPriority, e.SrcIpRanges, e.Conflict)
+}
+
+// splitRules splits the rules which have more srcIpRanges than maxSrcIpRanges into the rules of consecutive priorities,
+// such as 100, 101 and 102 for 25 addresses of the rule 100. The rules keep the other fields.
+// It returns the split rules for status, and PriorityConflictError if the priorities are used by other rules.
+// The rules of CLOUD_ARMOR_NETWORK are not split, because network matchers allow more addresses.
+func splitRules(spec *cloudarmorv1beta1.SecurityPolicySpec) ([]cloudarmorv1beta1.SplitRuleStatus, error) {
+	if spec.Type == cloudarmorv1beta1.SecurityPolicyTypeCloudArmorNetwork {
+		return nil, nil
+	}
+	used := make(map[int64]bool, len(spec.Rules)+1)
+	used[cloudarmorv1beta1.DefaultRulePriority] = true
+	for _, rule := range spec.Rules {
+		used[rule.Priority] = true
+	}
+
+	var splits []cloudarmorv1beta1.SplitRuleStatus
+	rules := make([]cloudarmorv1beta1.SecurityPolicyRule, 0, len(spec.Rules))
+	for _, rule := range spec.Rules {
+		ranges := canonicalIPRanges(rule.SrcIpRanges)
+		if len(ranges) <= maxSrcIpRanges {
+			rules = append(rules, rule)
+			continue
+		}
+		count := int64((len(ranges) + maxSrcIpRanges - 1) / maxSrcIpRanges)
+		split := cloudarmorv1beta1.SplitRuleStatus{Priority: rule.Priority}
+		for i := int64(0); i < count; i++ {
+			priority := rule.Priority + i
+			if i > 0 && used[priority] {
+				return nil, &PriorityConflictError{Priority: rule.Priority, Conflict: priority, SrcIpRanges: len(ranges), LastPriority: rule.Priority + count - 1}
+			}
+			used[priority] = true
+			end := (i + 1) * maxSrcIpRanges
+			if end > int64(len(ranges)) {
+				end = int64(len(ranges))
+			}
+			part := rule
+			part.Priority = priority
+			part.SrcIpRanges = ranges[i*maxSrcIpRanges : end]
+			rules = append(rules, part)
+			split.Priorities = append(split.Priorities, priority)
+		}
+		splits = append(splits, split)
+	}
+	spec.Rules = rules
+	return splits, nil
+}
@@ -0,0 +1,103 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("splitRules", func() {
+	var spec *cloudarmorv1beta1.SecurityPolicySpec
+
+	BeforeEach(func() {
+		spec = &cloudarmorv1beta1.SecurityPolicySpec{
+			Name:          "policy",
+			Description:   "description",
+			DefaultAction: "deny(403)",
+			Rules: []cloudarmorv1beta1.SecurityPolicyRule{
+				{Action: "allow", Description: "nodes", Priority: 100, SrcIpRanges: addresses(25)},
+				{Action: "allow", Description: "office", Priority: 200, SrcIpRanges: []string{"192.168.0.0/24"}},
+			},
+		}
+	})
+
+	It("should split the addresses over the limit into consecutive priorities", func() {
+		splits, err := splitRules(spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(splits).To(Equal([]cloudarmorv1beta1.SplitRuleStatus{{Priority: 100, Priorities: []int64{100, 101, 102}}}))
+		Expect(spec.Rules).To(HaveLen(4))
+		Expect(spec.Rules[0].SrcIpRanges).To(HaveLen(10))
+		Expect(spec.Rules[2].Priority).To(Equal(int64(102)))
+		Expect(spec.Rules[2].SrcIpRanges).To(HaveLen(5))
+		Expect(spec.Rules[2].Description).To(Equal("nodes"))
+		Expect(spec.Rules[3].Priority).To(Equal(int64(200)))
+	})
+
+	It("should not split the rule which fits after removing duplicates", func() {
+		spec.Rules[0].SrcIpRanges = append(addresses(10), "10.0.0.1/32")
+		splits, err := splitRules(spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(splits).To(BeEmpty())
+		Expect(spec.Rules).To(HaveLen(2))
+	})
+
+	It("should return PriorityConflictError when a split priority is used", func() {
+		spec.Rules[1].Priority = 102
+		_, err := splitRules(spec)
+		Expect(err).To(MatchError("rule 100 needs priorities 100-102 for 25 srcIpRanges, but priority 102 is used"))
+	})
+
+	It("should remove the split rules when the addresses shrink", func() {
+		ctx := context.Background()
+		api := &SecurityPolicyAPI{Log: logf.Log, Backend: NewFakeSecurityPolicyBackend()}
+		desired := spec.DeepCopy()
+		_, err := splitRules(desired)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = api.Create(ctx, desired)
+		Expect(err).NotTo(HaveOccurred())
+		current, err := api.Get(ctx, "policy")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(priorities(current)).To(Equal([]int64{100, 101, 102, 200, 2147483647}))
+
+		spec.Rules[0].SrcIpRanges = addresses(15)
+		desired = spec.DeepCopy()
+		splits, err := splitRules(desired)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(splits[0].Priorities).To(Equal([]int64{100, 101}))
+		_, err = api.Apply(ctx, desired, current)
+		Expect(err).NotTo(HaveOccurred())
+		current, err = api.Get(ctx, "policy")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(priorities(current)).To(Equal([]int64{100, 101, 200, 2147483647}))
+		Expect(srcIpRanges(current, 101)).To(HaveLen(5))
+	})
+})
+
+// addresses returns n addresses of 10.0.0.0/24.
+func addresses(n int) []string {
+	result := make([]string, n)
+	for i := range result {
+		result[i] = fmt.Sprintf("10.0.0.%d", i+1)
+	}
+	return result
+}
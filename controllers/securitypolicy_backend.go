@@ -0,0 +1,155 @@
+/*
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"golang.org/x/oauth2/google"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// SecurityPolicyBackend is the subset of the Compute securityPolicies API used by SecurityPolicyAPI.
+// Errors are returned as *googleapi.Error, so a missing policy is reported with code 404.
+type SecurityPolicyBackend interface {
+	Get(ctx context.Context, name string) (*compute.SecurityPolicy, error)
+	Insert(ctx context.Context, policy *compute.SecurityPolicy) (*compute.Operation, error)
+	Patch(ctx context.Context, name string, policy *compute.SecurityPolicy) (*compute.Operation, error)
+	Delete(ctx context.Context, name string) (*compute.Operation, error)
+	AddRule(ctx context.Context, name string, rule *compute.SecurityPolicyRule) (*compute.Operation, error)
+	PatchRule(ctx context.Context, name string, priority int64, rule *compute.SecurityPolicyRule) (*compute.Operation, error)
+	RemoveRule(ctx context.Context, name string, priority int64) (*compute.Operation, error)
+	GetOperation(ctx context.Context, name string) (*compute.Operation, error)
+	// InRegion returns the backend of the regionSecurityPolicies API in region.
+	// Empty region returns the backend of the global securityPolicies API.
+	InRegion(region string) SecurityPolicyBackend
+}
+
+// GCESecurityPolicyBackend is SecurityPolicyBackend backed by compute.SecurityPoliciesService,
+// or compute.RegionSecurityPoliciesService when Region is set.
+type GCESecurityPolicyBackend struct {
+	Service          *compute.SecurityPoliciesService
+	Operations       *compute.GlobalOperationsService
+	RegionService    *compute.RegionSecurityPoliciesService
+	RegionOperations *compute.RegionOperationsService
+	ProjectID        string
+	Region           string
+}
+
+// NewGCESecurityPolicyBackend returns GCESecurityPolicyBackend of the global securityPolicies API.
+// When projectID is empty, the project of the default credential is used.
+// opts are passed to compute.NewService, e.g. option.WithEndpoint to use another endpoint.
+func NewGCESecurityPolicyBackend(ctx context.Context, projectID string, opts ...option.ClientOption) (*GCESecurityPolicyBackend, error) {
+	computeService, err := compute.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if projectID == "" {
+		credentials, err := google.FindDefaultCredentials(ctx, compute.ComputeScope)
+		if err != nil {
+			return nil, err
+		}
+		projectID = credentials.ProjectID
+	}
+	return &GCESecurityPolicyBackend{
+		Service:          computeService.SecurityPolicies,
+		Operations:       computeService.GlobalOperations,
+		RegionService:    computeService.RegionSecurityPolicies,
+		RegionOperations: computeService.RegionOperations,
+		ProjectID:        projectID,
+	}, nil
+}
+
+// InRegion returns the backend sharing the services of b in region.
+func (b *GCESecurityPolicyBackend) InRegion(region string) SecurityPolicyBackend {
+	regional := *b
+	regional.Region = region
+	return &regional
+}
+
+// Get calls Security Policy Get API
+func (b *GCESecurityPolicyBackend) Get(ctx context.Context, name string) (*compute.SecurityPolicy, error) {
+	if b.Region != "" {
+		return b.RegionService.Get(b.ProjectID, b.Region, name).Context(ctx).Do()
+	}
+	return b.Service.Get(b.ProjectID, name).Context(ctx).Do()
+}
+
+// Insert calls Security Policy Insert API
+func (b *GCESecurityPolicyBackend) Insert(ctx context.Context, policy *compute.SecurityPolicy) (*compute.Operation, error) {
+	if b.Region != "" {
+		return b.RegionService.Insert(b.ProjectID, b.Region, policy).Context(ctx).Do()
+	}
+	return b.Service.Insert(b.ProjectID, policy).Context(ctx).Do()
+}
+
+// Patch calls Security Policy Patch API
+func (b *GCESecurityPolicyBackend) Patch(ctx context.Context, name string, policy *compute.SecurityPolicy) (*compute.Operation, error) {
+	if b.Region != "" {
+		return b.RegionService.Patch(b.ProjectID, b.Region, name, policy).Context(ctx).Do()
+	}
+	return b.Service.Patch(b.ProjectID, name, policy).Context(ctx).Do()
+}
+
+// Delete calls Security Policy Delete API
+func (b *GCESecurityPolicyBackend) Delete(ctx context.Context, name string) (*compute.Operation, error) {
+	if b.Region != "" {
+		return b.RegionService.Delete(b.ProjectID, b.Region, name).Context(ctx).Do()
+	}
+	return b.Service.Delete(b.ProjectID, name).Context(ctx).Do()
+}
+
+// AddRule calls Security Policy AddRule API
+func (b *GCESecurityPolicyBackend) AddRule(ctx context.Context, name string, rule *compute.SecurityPolicyRule) (*compute.Operation, error) {
+	if b.Region != "" {
+		return b.RegionService.AddRule(b.ProjectID, b.Region, name, rule).Context(ctx).Do()
+	}
+	return b.Service.AddRule(b.ProjectID, name, rule).Context(ctx).Do()
+}
+
+// PatchRule calls Security Policy PatchRule API
+func (b *GCESecurityPolicyBackend) PatchRule(ctx context.Context, name string, priority int64, rule *compute.SecurityPolicyRule) (*compute.Operation, error) {
+	if b.Region != "" {
+		return b.RegionService.PatchRule(b.ProjectID, b.Region, name, rule).Context(ctx).Priority(priority).Do()
+	}
+	return b.Service.PatchRule(b.ProjectID, name, rule).Context(ctx).Priority(priority).Do()
+}
+
+// RemoveRule calls Security Policy RemoveRule API
+func (b *GCESecurityPolicyBackend) RemoveRule(ctx context.Context, name string, priority int64) (*compute.Operation, error) {
+	if b.Region != "" {
+		return b.RegionService.RemoveRule(b.ProjectID, b.Region, name).Context(ctx).Priority(priority).Do()
+	}
+	return b.Service.RemoveRule(b.ProjectID, name).Context(ctx).Priority(priority).Do()
+}
+
+// GetOperation calls Global Operations Get API, or Region Operations Get API for the regional backend.
+func (b *GCESecurityPolicyBackend) GetOperation(ctx context.Context, name string) (*compute.Operation, error) {
+	if b.Region != "" {
+		return b.RegionOperations.Get(b.ProjectID, b.Region, name).Context(ctx).Do()
+	}
+	return b.Operations.Get(b.ProjectID, name).Context(ctx).Do()
+}
+
+// isNotFound returns true if err is googleapi 404 error.
+func isNotFound(err error) bool {
+	if e, ok := err.(*googleapi.Error); ok {
+		return e.Code == 404
+	}
+	return false
+}
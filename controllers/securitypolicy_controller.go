@@ -17,13 +17,21 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/go-logr/logr"
 	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -31,13 +39,26 @@ import (
 // SecurityPolicyReconciler reconciles a SecurityPolicy object
 type SecurityPolicyReconciler struct {
 	client.Client
-	Log logr.Logger
+	Log      logr.Logger
+	Backend  SecurityPolicyBackend
+	Recorder record.EventRecorder
+	// ResyncInterval is the interval to compare the security policy in Cloud Armor with the spec again.
+	// Zero disables the resync.
+	ResyncInterval time.Duration
+	// APIReader reads the ConfigMaps of addressSource from the API server,
+	// so that the manager does not cache the ConfigMaps of the cluster. Defaults to the client.
+	APIReader client.Reader
+	// WatchConfigMaps reconciles the security policies when the ConfigMaps of their addressSource change.
+	// The manager then caches the ConfigMaps of the cluster, which needs to list and watch them.
+	WatchConfigMaps bool
 }
 
 // Reconcile logic
 // +kubebuilder:rbac:groups=cloudarmor.matsumo.dev,resources=securitypolicies,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=cloudarmor.matsumo.dev,resources=securitypolicies/status,verbs=get;update;patch
-// +kubebuilder:rbac:groups="",resources=node,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *SecurityPolicyReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -63,72 +84,274 @@ func (r *SecurityPolicyReconciler) Reconcile(req ctrl.Request) (ctrl.Result, err
 			if err := r.deleteExternalDependency(instance); err != nil {
 				return reconcile.Result{}, err
 			}
-			// remove our finalizer from the list and update it.
+			// remove our finalizer from the list and patch it.
+			patch := client.MergeFrom(instance.DeepCopy())
 			instance.ObjectMeta.Finalizers = removeString(instance.ObjectMeta.Finalizers, myFinalizerName)
-			if err := r.Update(context.Background(), instance); err != nil {
+			if err := r.Patch(ctx, instance, patch); err != nil {
 				return reconcile.Result{}, err
 			}
 		}
 		return ctrl.Result{}, nil
 	}
-	instance.Status.Name = instance.Spec.Name
-	instance.Status.Description = instance.Spec.Description
-	instance.Status.DefaultAction = instance.Spec.DefaultAction
-	instance.Status.Rules = instance.Spec.Rules
 	if !containsString(instance.ObjectMeta.Finalizers, myFinalizerName) {
+		patch := client.MergeFrom(instance.DeepCopy())
 		instance.ObjectMeta.Finalizers = append(instance.ObjectMeta.Finalizers, myFinalizerName)
+		if err := r.Patch(ctx, instance, patch); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	original := instance.DeepCopy()
+	err = instance.Spec.Validate()
+	if err == nil && instance.Status.ID != "" && instance.Status.Region != instance.Spec.Region {
+		// the policy in the old region would be left behind.
+		err = fmt.Errorf("region of security policy %s can not be changed from %q to %q", instance.Status.Name, instance.Status.Region, instance.Spec.Region)
+	}
+	if policyType := string(securityPolicyType(&instance.Spec)); err == nil && instance.Status.ID != "" && instance.Status.Type != "" && instance.Status.Type != policyType {
+		// Cloud Armor can not change the type of a policy.
+		err = fmt.Errorf("type of security policy %s can not be changed from %s to %s", instance.Status.Name, instance.Status.Type, policyType)
+	}
+	if err != nil {
+		// invalid spec is not requeued, it needs a change of the custom resource.
+		setCondition(instance, cloudarmorv1beta1.ConditionSynced, corev1.ConditionFalse, "InvalidSpec", err.Error())
+		if updateErr := r.reconcileFailed(ctx, instance, original, "InvalidSpec", err); updateErr != nil {
+			return reconcile.Result{RequeueAfter: 5 * time.Second}, updateErr
+		}
+		return reconcile.Result{}, nil
 	}
-	nodeCalculator := &NodeCalculator{Log: r.Log, Reconciler: r}
-	instance, err = nodeCalculator.Calculate(instance)
+	nodeCalculator := &NodeCalculator{Log: r.Log, Reconciler: r, Namespace: instance.Namespace}
+	desired, err := nodeCalculator.Calculate(&instance.Spec)
 	if err != nil {
+		setCondition(instance, cloudarmorv1beta1.ConditionNodeAddressesResolved, corev1.ConditionFalse, "ListNodesFailed", err.Error())
+		if updateErr := r.reconcileFailed(ctx, instance, original, "ListNodesFailed", err); updateErr != nil {
+			return reconcile.Result{RequeueAfter: 5 * time.Second}, updateErr
+		}
 		return reconcile.Result{}, err
 	}
+	setCondition(instance, cloudarmorv1beta1.ConditionNodeAddressesResolved, corev1.ConditionTrue, "Resolved", "node addresses are resolved.")
+	now := time.Now()
+	instance.Status.HeldAddresses = holdAddresses(&instance.Status, desired, now)
+	nodeAddresses := nodeRuleAddresses(desired)
+	splits, err := splitRules(desired)
+	if err != nil {
+		// the priorities are free again by a change of the spec or nodes, which triggers the reconcile.
+		setCondition(instance, cloudarmorv1beta1.ConditionSynced, corev1.ConditionFalse, "PriorityConflict", err.Error())
+		if updateErr := r.reconcileFailed(ctx, instance, original, "PriorityConflict", err); updateErr != nil {
+			return reconcile.Result{RequeueAfter: 5 * time.Second}, updateErr
+		}
+		return reconcile.Result{}, nil
+	}
 
-	api := SecurityPolicyAPI{Log: r.Log}
+	api := SecurityPolicyAPI{Log: r.Log, Backend: r.Backend.InRegion(instance.Spec.Region)}
+	driftAction := instance.Spec.DriftAction
+	if driftAction == "" {
+		driftAction = cloudarmorv1beta1.DriftActionCorrect
+	}
+	var drift *SecurityPolicyChanges
 	err = retry(
 		func() error {
-			gceCurrentInstance, err := api.Get(ctx, instance.Status.Name)
+			gceCurrentInstance, err := api.Get(ctx, desired.Name)
 			if err != nil {
 				return err
 			}
+			var operation string
+			drift = nil
+			applied := true
 			if gceCurrentInstance == nil {
 				log.Info("Create Security Policy")
-				if err := api.Create(ctx, &instance.Status); err != nil {
-					return err
-				}
+				operation, err = api.Create(ctx, desired)
 			} else {
-				log.Info("Apply Security Policy")
-				if err := api.Apply(ctx, &instance.Status, gceCurrentInstance); err != nil {
-					return err
+				if inSync(original) && !nodeAddressesChanged(original, nodeAddresses) {
+					// the spec and node addresses are already applied, so the differences are made outside of the operator.
+					if changes := api.Diff(desired, gceCurrentInstance); !changes.Empty() {
+						drift = changes
+					}
+				}
+				if drift != nil && driftAction == cloudarmorv1beta1.DriftActionReport {
+					log.Info("Report drift of Security Policy", "changes", drift.String())
+					applied = false
+				} else {
+					log.Info("Apply Security Policy")
+					operation, err = api.Apply(ctx, desired, gceCurrentInstance)
+				}
+			}
+			if operation != "" {
+				instance.Status.LastOperation = operation
+			}
+			if err != nil {
+				return err
+			}
+			observed, err := api.Get(ctx, desired.Name)
+			if err != nil {
+				return err
+			}
+			if observed != nil {
+				securityPolicyToStatus(observed, &instance.Status)
+				instance.Status.SplitRules = splits
+				if applied {
+					instance.Status.AppliedNodeAddresses = nodeAddresses
+					instance.Status.HeldAddresses = unexpiredAddresses(instance.Status.HeldAddresses, now)
 				}
+				now := metav1.Now()
+				instance.Status.LastSyncTime = &now
 			}
 			return nil
 		},
 	)
+	if drift != nil {
+		driftDetectedTotal.WithLabelValues(instance.Namespace, instance.Name, string(driftAction)).Inc()
+		r.Recorder.Event(instance, corev1.EventTypeWarning, "DriftDetected", "security policy was changed outside of the operator: "+drift.String())
+	}
 	if err != nil {
-		return ctrl.Result{}, err
+		reason := "APIError"
+		switch e := err.(type) {
+		case *InsertError:
+			// classified errors are recorded, and requeued as the reason requires.
+			reason = "Insert" + string(e.Reason)
+			setCondition(instance, cloudarmorv1beta1.ConditionSynced, corev1.ConditionFalse, reason, err.Error())
+			if updateErr := r.reconcileFailed(ctx, instance, original, reason, err); updateErr != nil {
+				return reconcile.Result{RequeueAfter: 5 * time.Second}, updateErr
+			}
+			return e.Result(), nil
+		case *OperationError:
+			reason = "OperationFailed"
+		}
+		setCondition(instance, cloudarmorv1beta1.ConditionSynced, corev1.ConditionFalse, reason, err.Error())
+		if updateErr := r.reconcileFailed(ctx, instance, original, reason, err); updateErr != nil {
+			return reconcile.Result{RequeueAfter: 5 * time.Second}, updateErr
+		}
+		return reconcile.Result{}, err
 	}
 
-	instance.Status.Condition = "security operator updated."
-	if err := r.Update(ctx, instance); err != nil {
+	switch {
+	case drift != nil && driftAction == cloudarmorv1beta1.DriftActionReport:
+		message := "security policy was changed outside of the operator: " + drift.String()
+		setCondition(instance, cloudarmorv1beta1.ConditionSynced, corev1.ConditionFalse, "DriftDetected", message)
+		setCondition(instance, cloudarmorv1beta1.ConditionDegraded, corev1.ConditionFalse, "DriftDetected", "")
+		setCondition(instance, cloudarmorv1beta1.ConditionReady, corev1.ConditionFalse, "DriftDetected", message)
+	default:
+		if drift != nil {
+			r.Recorder.Event(instance, corev1.EventTypeNormal, "DriftCorrected", "security policy is synced with the spec again: "+drift.String())
+		}
+		setCondition(instance, cloudarmorv1beta1.ConditionSynced, corev1.ConditionTrue, "Synced", "security policy is synced with Cloud Armor.")
+		setCondition(instance, cloudarmorv1beta1.ConditionDegraded, corev1.ConditionFalse, "Synced", "")
+		setCondition(instance, cloudarmorv1beta1.ConditionReady, corev1.ConditionTrue, "Synced", "security policy is ready.")
+	}
+	if err := r.Status().Patch(ctx, instance, client.MergeFrom(original)); err != nil {
 		return reconcile.Result{RequeueAfter: 5 * time.Second}, err
 	}
 
-	return ctrl.Result{}, nil
+	// the held addresses are removed from the rules when they expire.
+	return ctrl.Result{RequeueAfter: requeueAfter(instance.Status.HeldAddresses, r.ResyncInterval, now)}, nil
+}
+
+// inSync returns true if the last reconcile synced the current generation and node addresses with Cloud Armor.
+// A drift reported for the current generation also counts as synced, so that it is reported until resolved.
+func inSync(instance *cloudarmorv1beta1.SecurityPolicy) bool {
+	if instance.Status.LastSyncTime == nil {
+		return false
+	}
+	synced := instance.Status.GetCondition(cloudarmorv1beta1.ConditionSynced)
+	if synced == nil || synced.ObservedGeneration != instance.Generation {
+		return false
+	}
+	if synced.Status != corev1.ConditionTrue && synced.Reason != "DriftDetected" {
+		return false
+	}
+	return instance.Status.IsConditionTrue(cloudarmorv1beta1.ConditionNodeAddressesResolved)
+}
+
+// nodeRuleAddresses returns the resolved addresses of nodePoolSelectors rules by the priority in the spec.
+func nodeRuleAddresses(desired *cloudarmorv1beta1.SecurityPolicySpec) []cloudarmorv1beta1.NodeAddressesStatus {
+	var result []cloudarmorv1beta1.NodeAddressesStatus
+	for _, rule := range desired.Rules {
+		if len(rule.NodePoolSelectors) == 0 {
+			continue
+		}
+		result = append(result, cloudarmorv1beta1.NodeAddressesStatus{Priority: rule.Priority, SrcIpRanges: canonicalIPRanges(rule.SrcIpRanges)})
+	}
+	return result
+}
+
+// nodeAddressesChanged returns true if the resolved addresses of nodePoolSelectors rules differ from the addresses
+// the operator applied last, so that the differences are applied as changes of the nodes, not as drift.
+// The observed rules are not compared, because a drift reported and not corrected would look like a change of the nodes.
+func nodeAddressesChanged(instance *cloudarmorv1beta1.SecurityPolicy, resolved []cloudarmorv1beta1.NodeAddressesStatus) bool {
+	applied := make(map[int64][]string, len(instance.Status.AppliedNodeAddresses))
+	for _, addresses := range instance.Status.AppliedNodeAddresses {
+		applied[addresses.Priority] = canonicalIPRanges(addresses.SrcIpRanges)
+	}
+	for _, addresses := range resolved {
+		previous, ok := applied[addresses.Priority]
+		if !ok || !reflect.DeepEqual(previous, addresses.SrcIpRanges) {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileFailed records the failure on the resource with Degraded and Ready conditions.
+func (r *SecurityPolicyReconciler) reconcileFailed(ctx context.Context, instance, original *cloudarmorv1beta1.SecurityPolicy, reason string, cause error) error {
+	log := r.Log.WithValues("securitypolicy", instance.Name)
+	log.Error(cause, "Reconcile failed", "reason", reason)
+
+	setCondition(instance, cloudarmorv1beta1.ConditionDegraded, corev1.ConditionTrue, reason, cause.Error())
+	setCondition(instance, cloudarmorv1beta1.ConditionReady, corev1.ConditionFalse, reason, cause.Error())
+	return r.Status().Patch(ctx, instance, client.MergeFrom(original))
+}
+
+// setCondition sets the condition for the current generation.
+func setCondition(instance *cloudarmorv1beta1.SecurityPolicy, conditionType cloudarmorv1beta1.SecurityPolicyConditionType, status corev1.ConditionStatus, reason, message string) {
+	instance.Status.SetCondition(cloudarmorv1beta1.SecurityPolicyCondition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: instance.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
 }
 
 // SetupWithManager is reconcile control.
+// Node events are mapped to the security policies which select the node, through the index of nodePoolSelectors.
+// Of the annotations, only the changes of the ones addressSource reads pass, through the index of the annotations.
+// ConfigMap events are mapped to the security policies which read the ConfigMap, through the index of addressSource,
+// when WatchConfigMaps is set. Otherwise the changes of the ConfigMaps are applied at the resync.
 func (r *SecurityPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&cloudarmorv1beta1.SecurityPolicy{}).
-		Complete(r)
+	if err := mgr.GetFieldIndexer().IndexField(&cloudarmorv1beta1.SecurityPolicy{}, nodePoolSelectorKeyIndex, indexNodePoolSelectorKeys); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(&cloudarmorv1beta1.SecurityPolicy{}, configMapNameIndex, indexConfigMapNames); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(&cloudarmorv1beta1.SecurityPolicy{}, annotationKeyIndex, indexAnnotationKeys); err != nil {
+		return err
+	}
+	c, err := controller.New("securitypolicy", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+	err = c.Watch(&source.Kind{Type: &cloudarmorv1beta1.SecurityPolicy{}}, &handler.EnqueueRequestForObject{}, &SecurityPolicyEventPredicate{})
+	if err != nil {
+		return err
+	}
+	mapper := &SecurityPolicyNodeMapper{Client: mgr.GetClient(), Log: r.Log.WithName("node")}
+	predicate := &NodeEventPredicate{Client: mgr.GetClient(), Log: r.Log.WithName("node")}
+	err = c.Watch(&source.Kind{Type: &corev1.Node{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: mapper}, predicate)
+	if err != nil || !r.WatchConfigMaps {
+		return err
+	}
+	configMapMapper := &SecurityPolicyConfigMapMapper{Client: mgr.GetClient(), Log: r.Log.WithName("configmap")}
+	return c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: configMapMapper}, &ConfigMapEventPredicate{})
 }
 
 //  delete dependency bucket.
 func (r *SecurityPolicyReconciler) deleteExternalDependency(instance *cloudarmorv1beta1.SecurityPolicy) error {
 	ctx := context.Background()
-	api := SecurityPolicyAPI{Log: r.Log}
-	err := api.Delete(ctx, instance.Status.Name)
+	name, region := instance.Status.Name, instance.Status.Region
+	if name == "" {
+		name, region = instance.Spec.Name, instance.Spec.Region
+	}
+	api := SecurityPolicyAPI{Log: r.Log, Backend: r.Backend.InRegion(region)}
+	err := api.Delete(ctx, name)
 	return err
 }
 
@@ -159,6 +382,10 @@ func retry(fn func() error) error {
 	var err error = nil
 	for i > 0 {
 		if err = fn(); err != nil {
+			if _, ok := err.(*InsertError); ok {
+				// classified errors are handled by the caller.
+				return err
+			}
 			i--
 			if i > 0 {
 				time.Sleep(sleepTime)
@@ -0,0 +1,117 @@
+//go:build integration
+// +build integration
+
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("SecurityPolicyReconciler", func() {
+	const timeout = 30 * time.Second
+
+	It("should create, update and delete the security policy through the compute API", func() {
+		ctx := context.Background()
+		key := types.NamespacedName{Name: "e2e", Namespace: "default"}
+		instance := &cloudarmorv1beta1.SecurityPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Spec: cloudarmorv1beta1.SecurityPolicySpec{
+				Name:          "e2e-policy",
+				Description:   "e2e",
+				DefaultAction: "deny(403)",
+				Rules: []cloudarmorv1beta1.SecurityPolicyRule{
+					{Action: "allow", Description: "rule 1", Priority: 100, SrcIpRanges: []string{"192.168.0.0/24"}},
+				},
+			},
+		}
+
+		By("creating the custom resource")
+		Expect(k8sClient.Create(ctx, instance)).To(Succeed())
+		Eventually(func() []int64 {
+			policy := computeServer.SecurityPolicy(testProjectID, "e2e-policy")
+			if policy == nil {
+				return nil
+			}
+			return priorities(policy)
+		}, timeout).Should(Equal([]int64{100, 2147483647}))
+		Eventually(func() bool {
+			fetched := &cloudarmorv1beta1.SecurityPolicy{}
+			if err := k8sClient.Get(ctx, key, fetched); err != nil {
+				return false
+			}
+			return fetched.Status.IsConditionTrue(cloudarmorv1beta1.ConditionReady)
+		}, timeout).Should(BeTrue())
+
+		By("reading back the observed state into status")
+		fetched := &cloudarmorv1beta1.SecurityPolicy{}
+		Expect(k8sClient.Get(ctx, key, fetched)).To(Succeed())
+		Expect(fetched.Status.ID).NotTo(BeEmpty())
+		Expect(fetched.Status.Fingerprint).NotTo(BeEmpty())
+		Expect(fetched.Status.LastSyncTime).NotTo(BeNil())
+		Expect(fetched.Status.Rules).To(HaveLen(2))
+		Expect(fetched.Status.Rules[0].SrcIpRanges).To(Equal([]string{"192.168.0.0/24"}))
+
+		By("updating the rules")
+		Eventually(func() error {
+			if err := k8sClient.Get(ctx, key, instance); err != nil {
+				return err
+			}
+			instance.Spec.Rules[0].SrcIpRanges = []string{"192.168.1.0/24"}
+			return k8sClient.Update(ctx, instance)
+		}, timeout).Should(Succeed())
+		Eventually(func() []string {
+			policy := computeServer.SecurityPolicy(testProjectID, "e2e-policy")
+			return srcIpRanges(policy, 100)
+		}, timeout).Should(Equal([]string{"192.168.1.0/24"}))
+
+		By("correcting a rule changed outside of the operator")
+		outside, err := NewGCESecurityPolicyBackend(ctx, testProjectID,
+			option.WithEndpoint(computeServer.Endpoint()), option.WithoutAuthentication())
+		Expect(err).NotTo(HaveOccurred())
+		_, err = outside.PatchRule(ctx, "e2e-policy", 100, &compute.SecurityPolicyRule{
+			Action:      "allow",
+			Description: "rule 1",
+			Priority:    100,
+			Match: &compute.SecurityPolicyRuleMatcher{
+				VersionedExpr: "SRC_IPS_V1",
+				Config:        &compute.SecurityPolicyRuleMatcherConfig{SrcIpRanges: []string{"10.0.0.0/8"}},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() []string {
+			policy := computeServer.SecurityPolicy(testProjectID, "e2e-policy")
+			return srcIpRanges(policy, 100)
+		}, timeout).Should(Equal([]string{"192.168.1.0/24"}))
+
+		By("deleting the custom resource")
+		Expect(k8sClient.Delete(ctx, instance)).To(Succeed())
+		Eventually(func() *compute.SecurityPolicy {
+			return computeServer.SecurityPolicy(testProjectID, "e2e-policy")
+		}, timeout).Should(BeNil())
+	})
+})
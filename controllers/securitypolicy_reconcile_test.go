@@ -0,0 +1,214 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// These specs run Reconcile offline, with the fake client and FakeSecurityPolicyBackend.
+var _ = Describe("SecurityPolicyReconciler with the fake backend", func() {
+	var (
+		ctx        context.Context
+		key        types.NamespacedName
+		backend    *FakeSecurityPolicyBackend
+		reconciler *SecurityPolicyReconciler
+	)
+
+	newReconciler := func(objs ...runtime.Object) {
+		// the fake client decodes the patched objects with the scheme of client-go.
+		Expect(cloudarmorv1beta1.AddToScheme(scheme.Scheme)).To(Succeed())
+		backend = NewFakeSecurityPolicyBackend()
+		reconciler = &SecurityPolicyReconciler{
+			Client:   fake.NewFakeClientWithScheme(scheme.Scheme, objs...),
+			Log:      logf.Log,
+			Backend:  backend,
+			Recorder: record.NewFakeRecorder(100),
+		}
+	}
+
+	reconcile := func() *cloudarmorv1beta1.SecurityPolicy {
+		_, err := reconciler.Reconcile(ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		instance := &cloudarmorv1beta1.SecurityPolicy{}
+		Expect(reconciler.Get(ctx, key, instance)).To(Succeed())
+		return instance
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		key = types.NamespacedName{Name: "offline", Namespace: "default"}
+		newReconciler(&cloudarmorv1beta1.SecurityPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Spec: cloudarmorv1beta1.SecurityPolicySpec{
+				Name:          "offline-policy",
+				Description:   "offline",
+				DefaultAction: "deny(403)",
+				Rules: []cloudarmorv1beta1.SecurityPolicyRule{
+					{Action: "allow", Description: "rule 1", Priority: 100, SrcIpRanges: []string{"192.168.0.0/24"}},
+				},
+			},
+		})
+	})
+
+	It("should create, update and delete the security policy", func() {
+		By("creating the security policy")
+		instance := reconcile()
+		Expect(instance.Finalizers).To(ContainElement("securitypolicy.finalizer.cloudarmor.matsumo.dev"))
+		Expect(instance.Status.IsConditionTrue(cloudarmorv1beta1.ConditionReady)).To(BeTrue())
+		Expect(instance.Status.ID).NotTo(BeEmpty())
+		policy, err := backend.Get(ctx, "offline-policy")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(priorities(policy)).To(Equal([]int64{100, 2147483647}))
+
+		By("updating the rules")
+		instance.Spec.Rules[0].SrcIpRanges = []string{"192.168.1.0/24"}
+		instance.Spec.Rules = append(instance.Spec.Rules, cloudarmorv1beta1.SecurityPolicyRule{
+			Action: "deny(403)", Description: "rule 2", Priority: 200, SrcIpRanges: []string{"10.0.0.0/8"},
+		})
+		Expect(reconciler.Update(ctx, instance)).To(Succeed())
+		instance = reconcile()
+		Expect(instance.Status.IsConditionTrue(cloudarmorv1beta1.ConditionReady)).To(BeTrue())
+		policy, err = backend.Get(ctx, "offline-policy")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(priorities(policy)).To(Equal([]int64{100, 200, 2147483647}))
+		Expect(srcIpRanges(policy, 100)).To(Equal([]string{"192.168.1.0/24"}))
+
+		By("deleting the security policy")
+		// the fake client keeps a list removed by a merge patch, so another finalizer keeps the list.
+		now := metav1.Now()
+		instance.DeletionTimestamp = &now
+		instance.Finalizers = append(instance.Finalizers, "example.com/other")
+		Expect(reconciler.Update(ctx, instance)).To(Succeed())
+		instance = reconcile()
+		_, err = backend.Get(ctx, "offline-policy")
+		Expect(isNotFound(err)).To(BeTrue())
+		Expect(instance.Finalizers).To(Equal([]string{"example.com/other"}))
+	})
+
+	It("should not requeue a change of the policy type", func() {
+		instance := reconcile()
+		Expect(instance.Status.Type).To(Equal("CLOUD_ARMOR"))
+
+		instance.Spec.Type = cloudarmorv1beta1.SecurityPolicyTypeCloudArmorEdge
+		Expect(reconciler.Update(ctx, instance)).To(Succeed())
+		operations := len(backend.Operations())
+		result, err := reconciler.Reconcile(ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(ctrl.Result{}))
+		Expect(reconciler.Get(ctx, key, instance)).To(Succeed())
+		synced := instance.Status.GetCondition(cloudarmorv1beta1.ConditionSynced)
+		Expect(synced.Reason).To(Equal("InvalidSpec"))
+		Expect(synced.Message).To(ContainSubstring("can not be changed from CLOUD_ARMOR to CLOUD_ARMOR_EDGE"))
+		Expect(backend.Operations()).To(HaveLen(operations))
+	})
+
+	It("should report drift of a node rule until the nodes change", func() {
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"pool": "default"}},
+			Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeExternalIP, Address: "203.0.113.1"}}},
+		}
+		newReconciler(node, &cloudarmorv1beta1.SecurityPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Spec: cloudarmorv1beta1.SecurityPolicySpec{
+				Name:          "offline-policy",
+				Description:   "offline",
+				DefaultAction: "deny(403)",
+				DriftAction:   cloudarmorv1beta1.DriftActionReport,
+				Rules: []cloudarmorv1beta1.SecurityPolicyRule{
+					{Action: "allow", Description: "nodes", Priority: 200, NodePoolSelectors: []cloudarmorv1beta1.LabelSelectors{{Key: "pool", Value: "default"}}},
+				},
+			},
+		})
+		instance := reconcile()
+		Expect(instance.Status.IsConditionTrue(cloudarmorv1beta1.ConditionReady)).To(BeTrue())
+
+		By("changing the node rule outside of the operator")
+		policy, err := backend.Get(ctx, "offline-policy")
+		Expect(err).NotTo(HaveOccurred())
+		drifted := copySecurityPolicyRule(policy.Rules[0])
+		drifted.Match.Config.SrcIpRanges = []string{"198.51.100.1/32"}
+		_, err = backend.PatchRule(ctx, "offline-policy", 200, drifted)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the drift read back into status.rules on the first resync must not look like a change of the nodes on the next.
+		for i := 0; i < 2; i++ {
+			instance = reconcile()
+			synced := instance.Status.GetCondition(cloudarmorv1beta1.ConditionSynced)
+			Expect(synced.Reason).To(Equal("DriftDetected"))
+			policy, err = backend.Get(ctx, "offline-policy")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(srcIpRanges(policy, 200)).To(Equal([]string{"198.51.100.1/32"}))
+		}
+
+		By("changing the address of the node")
+		node.Status.Addresses[0].Address = "203.0.113.2"
+		Expect(reconciler.Update(ctx, node)).To(Succeed())
+		instance = reconcile()
+		Expect(instance.Status.IsConditionTrue(cloudarmorv1beta1.ConditionReady)).To(BeTrue())
+		policy, err = backend.Get(ctx, "offline-policy")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(srcIpRanges(policy, 200)).To(Equal([]string{"203.0.113.2/32"}))
+		Expect(instance.Status.AppliedNodeAddresses).To(Equal([]cloudarmorv1beta1.NodeAddressesStatus{
+			{Priority: 200, SrcIpRanges: []string{"203.0.113.2/32"}},
+		}))
+	})
+})
+
+var _ = Describe("nodeAddressesChanged", func() {
+	It("should tell changes of the node addresses from drift", func() {
+		policy := &cloudarmorv1beta1.SecurityPolicy{
+			Spec: cloudarmorv1beta1.SecurityPolicySpec{
+				Rules: []cloudarmorv1beta1.SecurityPolicyRule{
+					{Action: "allow", Priority: 100, SrcIpRanges: []string{"192.168.0.0/24"}},
+					{Action: "allow", Priority: 101, NodePoolSelectors: []cloudarmorv1beta1.LabelSelectors{{Key: "pool", Value: "default"}}},
+					{Action: "allow", Priority: 102, NodePoolSelectors: []cloudarmorv1beta1.LabelSelectors{{Key: "pool", Value: "spot"}}},
+				},
+			},
+		}
+		policy.Status.AppliedNodeAddresses = []cloudarmorv1beta1.NodeAddressesStatus{
+			{Priority: 101, SrcIpRanges: []string{"203.0.113.1/32"}},
+			{Priority: 102, SrcIpRanges: []string{"203.0.113.2/32"}},
+		}
+		// the observed rules have a drift, which is not a change of the nodes.
+		policy.Status.Rules = []cloudarmorv1beta1.SecurityPolicyRuleStatus{
+			{Priority: 100, SrcIpRanges: []string{"192.168.0.0/24"}},
+			{Priority: 101, SrcIpRanges: []string{"198.51.100.1/32"}},
+			{Priority: 102, SrcIpRanges: []string{"203.0.113.2/32"}},
+		}
+		desired := policy.Spec.DeepCopy()
+		desired.Rules[1].SrcIpRanges = []string{"203.0.113.1"}
+		desired.Rules[2].SrcIpRanges = []string{"203.0.113.2"}
+		Expect(nodeAddressesChanged(policy, nodeRuleAddresses(desired))).To(BeFalse())
+
+		desired.Rules[2].SrcIpRanges = []string{"203.0.113.2", "203.0.113.3"}
+		Expect(nodeAddressesChanged(policy, nodeRuleAddresses(desired))).To(BeTrue())
+	})
+})
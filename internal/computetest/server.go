@@ -0,0 +1,518 @@
+/*
+
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+		http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+
+// Package computetest provides a local stand-in for the Compute securityPolicies and regionSecurityPolicies REST API.
+package computetest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// defaultRulePriority is the priority of the rule Cloud Armor adds when the policy has none.
+const defaultRulePriority = 2147483647
+
+var (
+	securityPoliciesPath = regexp.MustCompile(`/(projects/[^/]+/(?:global|regions/[^/]+))/securityPolicies(?:/([^/]+))?(?:/(addRule|patchRule|removeRule|getRule))?$`)
+	operationsPath       = regexp.MustCompile(`/(projects/[^/]+/(?:global|regions/[^/]+))/operations/([^/]+)$`)
+)
+
+// Server serves securityPolicies, regionSecurityPolicies, globalOperations and regionOperations endpoints of compute/v1 over httptest.
+// Policies and operations are kept by scope, such as projects/PROJECT/global or projects/PROJECT/regions/REGION.
+type Server struct {
+	// PendingPolls is the number of operations.get calls answered with RUNNING before DONE.
+	PendingPolls int
+
+	httpServer *httptest.Server
+
+	mu         sync.Mutex
+	policies   map[string]*compute.SecurityPolicy
+	operations map[string]*operation
+	sequence   uint64
+	failure    *compute.OperationError
+}
+
+type operation struct {
+	op      *compute.Operation
+	pending int
+}
+
+// NewServer starts Server. Callers should call Close when finished.
+func NewServer() *Server {
+	s := &Server{
+		policies:   map[string]*compute.SecurityPolicy{},
+		operations: map[string]*operation{},
+	}
+	s.httpServer = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.httpServer.Close()
+}
+
+// Endpoint returns the base path to pass to option.WithEndpoint.
+func (s *Server) Endpoint() string {
+	return s.httpServer.URL + "/compute/v1/"
+}
+
+// SecurityPolicy returns the stored global policy, or nil if it does not exist.
+func (s *Server) SecurityPolicy(project, name string) *compute.SecurityPolicy {
+	return s.securityPolicy(fmt.Sprintf("projects/%s/global", project), name)
+}
+
+// RegionSecurityPolicy returns the stored regional policy, or nil if it does not exist.
+func (s *Server) RegionSecurityPolicy(project, region, name string) *compute.SecurityPolicy {
+	return s.securityPolicy(fmt.Sprintf("projects/%s/regions/%s", project, region), name)
+}
+
+func (s *Server) securityPolicy(scope, name string) *compute.SecurityPolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policy, ok := s.policies[scope+"/"+name]
+	if !ok {
+		return nil
+	}
+	out := &compute.SecurityPolicy{}
+	copyJSON(policy, out)
+	return out
+}
+
+// FailNextOperation makes the operation of the next mutation finish with the error.
+func (s *Server) FailNextOperation(code, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failure = &compute.OperationError{
+		Errors: []*compute.OperationErrorErrors{{Code: code, Message: message}},
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m := operationsPath.FindStringSubmatch(r.URL.Path); m != nil && r.Method == http.MethodGet {
+		s.getOperation(w, m[1], m[2])
+		return
+	}
+	m := securityPoliciesPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("unknown path %s", r.URL.Path))
+		return
+	}
+	scope, name, method := m[1], m[2], m[3]
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		s.list(w, scope)
+	case name == "" && r.Method == http.MethodPost:
+		s.insert(w, r, scope)
+	case method == "" && r.Method == http.MethodGet:
+		s.get(w, scope, name)
+	case method == "" && r.Method == http.MethodPatch:
+		s.patch(w, r, scope, name)
+	case method == "" && r.Method == http.MethodDelete:
+		s.delete(w, scope, name)
+	case method == "getRule" && r.Method == http.MethodGet:
+		s.getRule(w, r, scope, name)
+	case method == "addRule" && r.Method == http.MethodPost:
+		s.addRule(w, r, scope, name)
+	case method == "patchRule" && r.Method == http.MethodPost:
+		s.patchRule(w, r, scope, name)
+	case method == "removeRule" && r.Method == http.MethodPost:
+		s.removeRule(w, r, scope, name)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "badRequest", fmt.Sprintf("%s %s is not supported", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter, scope string) {
+	list := &compute.SecurityPolicyList{Kind: "compute#securityPolicyList", Items: []*compute.SecurityPolicy{}}
+	keys := []string{}
+	for key := range s.policies {
+		if strings.HasPrefix(key, scope+"/") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		list.Items = append(list.Items, s.policies[key])
+	}
+	writeJSON(w, list)
+}
+
+func (s *Server) insert(w http.ResponseWriter, r *http.Request, scope string) {
+	policy := &compute.SecurityPolicy{}
+	if !readJSON(w, r, policy) {
+		return
+	}
+	if policy.Name == "" {
+		writeError(w, http.StatusBadRequest, "required", "Required field 'name' not specified")
+		return
+	}
+	if _, ok := s.policies[scope+"/"+policy.Name]; ok {
+		writeError(w, http.StatusConflict, "alreadyExists", fmt.Sprintf("The resource '%s' already exists", s.selfLink(scope, policy.Name)))
+		return
+	}
+	priorities := map[int64]bool{}
+	for _, rule := range policy.Rules {
+		if priorities[rule.Priority] {
+			writeError(w, http.StatusBadRequest, "invalid", "Cannot have rules with the same priorities.")
+			return
+		}
+		priorities[rule.Priority] = true
+		rule.Kind = "compute#securityPolicyRule"
+	}
+	if !priorities[defaultRulePriority] {
+		policy.Rules = append(policy.Rules, &compute.SecurityPolicyRule{
+			Kind:        "compute#securityPolicyRule",
+			Action:      "allow",
+			Description: "default rule",
+			Priority:    defaultRulePriority,
+			Match: &compute.SecurityPolicyRuleMatcher{
+				VersionedExpr: "SRC_IPS_V1",
+				Config:        &compute.SecurityPolicyRuleMatcherConfig{SrcIpRanges: []string{"*"}},
+			},
+		})
+	}
+	s.sequence++
+	policy.Id = s.sequence
+	policy.Kind = "compute#securityPolicy"
+	policy.SelfLink = s.selfLink(scope, policy.Name)
+	if strings.Contains(scope, "/regions/") {
+		policy.Region = fmt.Sprintf("%s/compute/v1/%s", s.httpServer.URL, scope)
+	}
+	policy.CreationTimestamp = time.Now().Format(time.RFC3339)
+	s.touch(policy)
+	s.policies[scope+"/"+policy.Name] = policy
+	writeJSON(w, s.operation(scope, "insert", policy))
+}
+
+func (s *Server) get(w http.ResponseWriter, scope, name string) {
+	policy, ok := s.lookup(w, scope, name)
+	if !ok {
+		return
+	}
+	writeJSON(w, policy)
+}
+
+func (s *Server) patch(w http.ResponseWriter, r *http.Request, scope, name string) {
+	policy, ok := s.lookup(w, scope, name)
+	if !ok {
+		return
+	}
+	fields := map[string]interface{}{}
+	if !readJSON(w, r, &fields) {
+		return
+	}
+	if fingerprint, ok := fields["fingerprint"].(string); ok && fingerprint != "" && fingerprint != policy.Fingerprint {
+		writeError(w, http.StatusPreconditionFailed, "conditionNotMet", "Supplied fingerprint does not match current metadata fingerprint.")
+		return
+	}
+	if name, ok := fields["name"].(string); ok && name != "" && name != policy.Name {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid value for field 'resource.name'.")
+		return
+	}
+	patched := patchSecurityPolicy(policy, fields)
+	s.policies[scope+"/"+name] = patched
+	s.touch(patched)
+	writeJSON(w, s.operation(scope, "patch", patched))
+}
+
+// patchSecurityPolicy returns policy with the fields present in the request, and clears the null fields.
+// Rules and output only fields are kept.
+func patchSecurityPolicy(policy *compute.SecurityPolicy, fields map[string]interface{}) *compute.SecurityPolicy {
+	stored := map[string]interface{}{}
+	b, _ := json.Marshal(policy)
+	json.Unmarshal(b, &stored)
+	for key, value := range fields {
+		switch key {
+		case "id", "kind", "name", "selfLink", "fingerprint", "rules", "creationTimestamp":
+			continue
+		}
+		if value == nil {
+			delete(stored, key)
+			continue
+		}
+		stored[key] = value
+	}
+	out := &compute.SecurityPolicy{}
+	b, _ = json.Marshal(stored)
+	json.Unmarshal(b, out)
+	return out
+}
+
+func (s *Server) delete(w http.ResponseWriter, scope, name string) {
+	policy, ok := s.lookup(w, scope, name)
+	if !ok {
+		return
+	}
+	delete(s.policies, scope+"/"+name)
+	writeJSON(w, s.operation(scope, "delete", policy))
+}
+
+func (s *Server) getRule(w http.ResponseWriter, r *http.Request, scope, name string) {
+	policy, ok := s.lookup(w, scope, name)
+	if !ok {
+		return
+	}
+	priority, ok := readPriority(w, r)
+	if !ok {
+		return
+	}
+	i := ruleIndex(policy, priority)
+	if i < 0 {
+		writeInvalidPriority(w, priority)
+		return
+	}
+	writeJSON(w, policy.Rules[i])
+}
+
+func (s *Server) addRule(w http.ResponseWriter, r *http.Request, scope, name string) {
+	policy, ok := s.lookup(w, scope, name)
+	if !ok {
+		return
+	}
+	rule := &compute.SecurityPolicyRule{}
+	if !readJSON(w, r, rule) {
+		return
+	}
+	if ruleIndex(policy, rule.Priority) >= 0 {
+		writeError(w, http.StatusBadRequest, "invalid", "Cannot have rules with the same priorities.")
+		return
+	}
+	rule.Kind = "compute#securityPolicyRule"
+	policy.Rules = append(policy.Rules, rule)
+	s.touch(policy)
+	writeJSON(w, s.operation(scope, "addRule", policy))
+}
+
+func (s *Server) patchRule(w http.ResponseWriter, r *http.Request, scope, name string) {
+	policy, ok := s.lookup(w, scope, name)
+	if !ok {
+		return
+	}
+	priority, ok := readPriority(w, r)
+	if !ok {
+		return
+	}
+	fields := map[string]interface{}{}
+	if !readJSON(w, r, &fields) {
+		return
+	}
+	i := ruleIndex(policy, priority)
+	if i < 0 {
+		writeInvalidPriority(w, priority)
+		return
+	}
+	rule := patchSecurityPolicyRule(policy.Rules[i], fields)
+	rule.Kind = "compute#securityPolicyRule"
+	rule.Priority = priority
+	policy.Rules[i] = rule
+	s.touch(policy)
+	writeJSON(w, s.operation(scope, "patchRule", policy))
+}
+
+// patchSecurityPolicyRule returns rule with the fields of the request merged as a JSON merge patch.
+// Nested objects are merged, and the null fields are cleared.
+func patchSecurityPolicyRule(rule *compute.SecurityPolicyRule, fields map[string]interface{}) *compute.SecurityPolicyRule {
+	stored := map[string]interface{}{}
+	b, _ := json.Marshal(rule)
+	json.Unmarshal(b, &stored)
+	mergeJSONObject(stored, fields)
+	out := &compute.SecurityPolicyRule{}
+	b, _ = json.Marshal(stored)
+	json.Unmarshal(b, out)
+	return out
+}
+
+// mergeJSONObject merges patch into stored. Objects are merged recursively,
+// null removes the field, and other values replace it.
+func mergeJSONObject(stored, patch map[string]interface{}) {
+	for key, value := range patch {
+		object, isObject := value.(map[string]interface{})
+		switch {
+		case value == nil:
+			delete(stored, key)
+		case isObject:
+			storedObject, ok := stored[key].(map[string]interface{})
+			if !ok {
+				storedObject = map[string]interface{}{}
+			}
+			mergeJSONObject(storedObject, object)
+			stored[key] = storedObject
+		default:
+			stored[key] = value
+		}
+	}
+}
+
+func (s *Server) removeRule(w http.ResponseWriter, r *http.Request, scope, name string) {
+	policy, ok := s.lookup(w, scope, name)
+	if !ok {
+		return
+	}
+	priority, ok := readPriority(w, r)
+	if !ok {
+		return
+	}
+	i := ruleIndex(policy, priority)
+	if i < 0 || priority == defaultRulePriority {
+		writeInvalidPriority(w, priority)
+		return
+	}
+	policy.Rules = append(policy.Rules[:i], policy.Rules[i+1:]...)
+	s.touch(policy)
+	writeJSON(w, s.operation(scope, "removeRule", policy))
+}
+
+func (s *Server) getOperation(w http.ResponseWriter, scope, name string) {
+	o, ok := s.operations[scope+"/"+name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("The resource '%s/operations/%s' was not found", scope, name))
+		return
+	}
+	if o.pending > 0 {
+		o.pending--
+	}
+	if o.pending == 0 && o.op.Status != "DONE" {
+		o.op.Status = "DONE"
+		o.op.Progress = 100
+		o.op.EndTime = time.Now().Format(time.RFC3339)
+	}
+	writeJSON(w, o.op)
+}
+
+// lookup returns the policy, or writes 404 error.
+func (s *Server) lookup(w http.ResponseWriter, scope, name string) (*compute.SecurityPolicy, bool) {
+	policy, ok := s.policies[scope+"/"+name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("The resource '%s' was not found", s.selfLink(scope, name)))
+		return nil, false
+	}
+	return policy, true
+}
+
+// touch sorts rules by priority and renews the fingerprint.
+func (s *Server) touch(policy *compute.SecurityPolicy) {
+	sort.Slice(policy.Rules, func(i, j int) bool {
+		return policy.Rules[i].Priority < policy.Rules[j].Priority
+	})
+	s.sequence++
+	policy.Fingerprint = base64.StdEncoding.EncodeToString([]byte(strconv.FormatUint(s.sequence, 10)))
+}
+
+// operation registers a long-running operation for the mutation.
+func (s *Server) operation(scope, operationType string, policy *compute.SecurityPolicy) *compute.Operation {
+	s.sequence++
+	name := fmt.Sprintf("operation-%d", s.sequence)
+	op := &compute.Operation{
+		Kind:          "compute#operation",
+		Id:            s.sequence,
+		Name:          name,
+		OperationType: operationType,
+		Status:        "RUNNING",
+		InsertTime:    time.Now().Format(time.RFC3339),
+		StartTime:     time.Now().Format(time.RFC3339),
+		TargetId:      policy.Id,
+		TargetLink:    policy.SelfLink,
+		SelfLink:      fmt.Sprintf("%s/compute/v1/%s/operations/%s", s.httpServer.URL, scope, name),
+		Error:         s.failure,
+	}
+	s.failure = nil
+	if s.PendingPolls == 0 {
+		op.Status = "DONE"
+		op.Progress = 100
+		op.EndTime = op.StartTime
+	}
+	s.operations[scope+"/"+name] = &operation{op: op, pending: s.PendingPolls}
+	return op
+}
+
+func (s *Server) selfLink(scope, name string) string {
+	return fmt.Sprintf("%s/compute/v1/%s/securityPolicies/%s", s.httpServer.URL, scope, name)
+}
+
+func ruleIndex(policy *compute.SecurityPolicy, priority int64) int {
+	for i, rule := range policy.Rules {
+		if rule.Priority == priority {
+			return i
+		}
+	}
+	return -1
+}
+
+func readPriority(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	value := r.URL.Query().Get("priority")
+	if value == "" {
+		return 0, true
+	}
+	priority, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid value for field 'priority': '%s'.", value))
+		return 0, false
+	}
+	return priority, true
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "parseError", err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeInvalidPriority(w http.ResponseWriter, priority int64) {
+	writeError(w, http.StatusBadRequest, "invalid", fmt.Sprintf("Invalid value for field 'priority': '%d'.", priority))
+}
+
+// writeError writes the error document googleapi.CheckResponse understands.
+func writeError(w http.ResponseWriter, code int, reason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"errors": []map[string]string{
+				{"domain": "global", "reason": reason, "message": message},
+			},
+		},
+	})
+}
+
+func copyJSON(in, out interface{}) {
+	b, _ := json.Marshal(in)
+	json.Unmarshal(b, out)
+}
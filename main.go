@@ -16,11 +16,14 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"time"
 
 	cloudarmorv1beta1 "github.com/h-r-k-matsumoto/security-policy-operator/api/v1beta1"
 	"github.com/h-r-k-matsumoto/security-policy-operator/controllers"
+	"google.golang.org/api/option"
 	"k8s.io/apimachinery/pkg/runtime"
 	kscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
@@ -44,9 +47,21 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var projectID string
+	var computeEndpoint string
+	var resyncInterval time.Duration
+	var watchConfigMaps bool
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&projectID, "project", "",
+		"The project of the security policies. Defaults to the project of the default credential.")
+	flag.StringVar(&computeEndpoint, "compute-endpoint", "",
+		"The Compute API endpoint. Defaults to the Google Cloud endpoint.")
+	flag.DurationVar(&resyncInterval, "resync-interval", 10*time.Minute,
+		"The interval to compare the security policies in Cloud Armor with the custom resources again. 0 disables the resync.")
+	flag.BoolVar(&watchConfigMaps, "watch-configmaps", false,
+		"Reconcile the security policies when the ConfigMaps of their addressSource change, which needs to list and watch the ConfigMaps of the cluster. Otherwise the changes are applied at the resync.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.Logger(true))
@@ -61,17 +76,24 @@ func main() {
 		os.Exit(1)
 	}
 
-	err = (&controllers.SecurityPolicyReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("SecurityPolicy"),
-	}).SetupWithManager(mgr)
+	opts := []option.ClientOption{}
+	if computeEndpoint != "" {
+		opts = append(opts, option.WithEndpoint(computeEndpoint))
+	}
+	backend, err := controllers.NewGCESecurityPolicyBackend(context.Background(), projectID, opts...)
 	if err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "SecurityPolicy")
+		setupLog.Error(err, "unable to create security policy backend")
 		os.Exit(1)
 	}
-	err = (&controllers.SecurityPolicyNodeReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("SecurityPolicy(node)"),
+
+	err = (&controllers.SecurityPolicyReconciler{
+		Client:          mgr.GetClient(),
+		Log:             ctrl.Log.WithName("controllers").WithName("SecurityPolicy"),
+		Backend:         backend,
+		Recorder:        mgr.GetEventRecorderFor("securitypolicy-controller"),
+		ResyncInterval:  resyncInterval,
+		APIReader:       mgr.GetAPIReader(),
+		WatchConfigMaps: watchConfigMaps,
 	}).SetupWithManager(mgr)
 	if err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SecurityPolicy")